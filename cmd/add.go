@@ -6,17 +6,20 @@ package cmd
 import (
 	"os"
 	"path/filepath"
-	"regexp"
 
 	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/profiles"
 	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/spf13/cobra"
 )
 
-func linkAsDirMatchPattern(relPath string) string {
-	cleanPath := filepath.ToSlash(filepath.Clean(relPath))
-	escapedPath := regexp.QuoteMeta(cleanPath)
-	return escapedPath + "$"
+// linkAsDirMapping returns a mapping which links the directory at relPath,
+// relative to the dotfile directory, as a directory.
+func linkAsDirMapping(relPath string) *mapping.Mapping {
+	return &mapping.Mapping{
+		Path:      filepath.ToSlash(filepath.Clean(relPath)),
+		LinkAsDir: true,
+	}
 }
 
 // addCmd represents the add command
@@ -35,7 +38,7 @@ var addCmd = &cobra.Command{
 			return err
 		}
 
-		home, err := os.UserHomeDir()
+		home, err := targetHome()
 		if err != nil {
 			return err
 		}
@@ -46,13 +49,13 @@ var addCmd = &cobra.Command{
 				return err
 			}
 
-			relPath, err := filepath.Rel(home, absPath)
+			// Files go where linking the profile puts them back, such
+			// as the directory of the target they are in.
+			relPath, profilePath, err := profile.SourcePath(absPath, home)
 			if err != nil {
 				return err
 			}
 
-			profilePath := filepath.Join(profile.GetDotfileDirectory(), relPath)
-
 			if err := os.MkdirAll(filepath.Dir(profilePath), 0744); err != nil {
 				return err
 			}
@@ -62,21 +65,18 @@ var addCmd = &cobra.Command{
 			}
 
 			if linkAsDir {
-				m := &mapping.Mapping{
-					Match:     linkAsDirMatchPattern(relPath),
-					LinkAsDir: true,
-				}
-				if err := profile.AddMapping(m); err != nil {
+				if err := profile.AddMapping(linkAsDirMapping(relPath)); err != nil {
 					return err
 				}
 			}
 		}
 
-		return profile.Link(false)
+		return profile.Link(profiles.LinkOptions{Home: home})
 	},
 }
 
 func init() {
 	addCmd.Flags().Bool("link-as-dir", false, "Add the directory to the dotfile profile and create a link as dir mapping before linking")
+	addTargetFlag(addCmd)
 	RootCmd.AddCommand(addCmd)
 }
@@ -1,36 +1,37 @@
 package cmd
 
 import (
-	"regexp"
 	"testing"
 )
 
-func TestLinkAsDirMatchPatternMatchesProvidedDirectoryOnly(t *testing.T) {
-	pattern := linkAsDirMatchPattern(".agents")
-	rgx := regexp.MustCompile(pattern)
+func TestLinkAsDirMappingMatchesProvidedDirectoryOnly(t *testing.T) {
+	m := linkAsDirMapping(".agents")
 
-	if !rgx.MatchString("/tmp/repo/.agents") {
-		t.Fatalf("pattern %q should match directory root", pattern)
+	if !m.IsMatch("/tmp/repo/.agents", ".agents") {
+		t.Fatalf("mapping %s should match directory root", m)
 	}
 
-	if rgx.MatchString("/tmp/repo/.agents/skills/test.md") {
-		t.Fatalf("pattern %q should not match directory children", pattern)
+	if m.IsMatch("/tmp/repo/.agents/skills/test.md", ".agents/skills/test.md") {
+		t.Fatalf("mapping %s should not match directory children", m)
 	}
 
-	if rgx.MatchString("/tmp/repo/.agentsx") {
-		t.Fatalf("pattern %q should not match sibling paths", pattern)
+	if m.IsMatch("/tmp/repo/.agentsx", ".agentsx") {
+		t.Fatalf("mapping %s should not match sibling paths", m)
+	}
+
+	if m.IsMatch("/tmp/repo/nested/.agents", "nested/.agents") {
+		t.Fatalf("mapping %s should not match directories with the same name elsewhere", m)
 	}
 }
 
-func TestLinkAsDirMatchPatternEscapesRegexChars(t *testing.T) {
-	pattern := linkAsDirMatchPattern(".config/nvim/snippets")
-	rgx := regexp.MustCompile(pattern)
+func TestLinkAsDirMappingMatchesLiteralPaths(t *testing.T) {
+	m := linkAsDirMapping(".config/nvim/snippets")
 
-	if !rgx.MatchString("/tmp/repo/.config/nvim/snippets") {
-		t.Fatalf("pattern %q should match literal dotted directory", pattern)
+	if !m.IsMatch("/tmp/repo/.config/nvim/snippets", ".config/nvim/snippets") {
+		t.Fatalf("mapping %s should match literal dotted directory", m)
 	}
 
-	if rgx.MatchString("/tmp/repo/xconfig/nvim/snippets") {
-		t.Fatalf("pattern %q should treat dots as literals", pattern)
+	if m.IsMatch("/tmp/repo/xconfig/nvim/snippets", "xconfig/nvim/snippets") {
+		t.Fatalf("mapping %s should treat dots as literals", m)
 	}
 }
@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chasinglogic/dfm/internal/backup"
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Inspect and restore files dfm replaced when linking",
+}
+
+var backupListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List backups",
+	Aliases: []string{"ls"},
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		index, err := backup.LoadIndex()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tORIGINAL")
+		for _, b := range index.Backups {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", b.ID, b.CreatedAt.Local().Format(time.DateTime), b.Original)
+		}
+
+		return w.Flush()
+	},
+}
+
+var backupShowCmd = &cobra.Command{
+	Use:   "show <ID>",
+	Short: "Show a backup and the files it contains",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		index, err := backup.LoadIndex()
+		if err != nil {
+			return err
+		}
+
+		b, err := index.Find(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("ID:      ", b.ID)
+		fmt.Println("Created: ", b.CreatedAt.Local().Format(time.DateTime))
+		fmt.Println("Original:", b.Original)
+		fmt.Println("Stored:  ", b.Path)
+		fmt.Println("")
+
+		return filepath.WalkDir(b.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(filepath.Dir(b.Path), path)
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				rel += string(os.PathSeparator)
+			}
+
+			fmt.Println(rel)
+			return nil
+		})
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <ID|PATH>",
+	Short: "Restore a backup to where it came from",
+	Long: `Restore a backup to where it came from.
+
+The backup can be given by its ID or by the path it was backed up from, in
+which case the most recent backup of that path is restored. If a link dfm
+created is in the way it is removed first, anything else in the way causes the
+restore to fail.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		index, err := backup.LoadIndex()
+		if err != nil {
+			return err
+		}
+
+		b, err := index.Find(args[0])
+		if err != nil {
+			return err
+		}
+
+		m, err := manifest.Load()
+		if err != nil {
+			return err
+		}
+
+		if entry, ok := m.Get(b.Original); ok && entry.Owns() {
+			if err := os.Remove(entry.Target); err != nil {
+				return err
+			}
+
+			m.Remove(entry.Target)
+			if err := m.Save(); err != nil {
+				return err
+			}
+
+			fmt.Println("removed link:", entry.Target)
+		}
+
+		if _, err := backup.Restore(b.ID); err != nil {
+			return err
+		}
+
+		fmt.Println("restored:", b.Original)
+		return nil
+	},
+}
+
+func init() {
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupShowCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	RootCmd.AddCommand(backupCmd)
+}
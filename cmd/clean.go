@@ -11,12 +11,20 @@ import (
 	"strings"
 
 	"github.com/chasinglogic/dfm/internal/logger"
+	"github.com/chasinglogic/dfm/internal/manifest"
 	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/chasinglogic/dfm/internal/utils"
 	"github.com/spf13/cobra"
 )
 
-func cleanDeadSymlinks(rootPath, targetDir string) error {
-	targetDir = filepath.Clean(targetDir) + string(os.PathSeparator)
+// cleanDeadSymlinks removes the links under rootPath which point to something
+// missing in one of dirs.
+func cleanDeadSymlinks(rootPath string, dirs ...string) error {
+	prefixes := make([]string, len(dirs))
+	for idx, dir := range dirs {
+		prefixes[idx] = filepath.Clean(dir) + string(os.PathSeparator)
+	}
+
 	return filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			logger.Debug().Str("path", path).Err(err).Msg("error accessing directory")
@@ -29,14 +37,17 @@ func cleanDeadSymlinks(rootPath, targetDir string) error {
 				return err
 			}
 
-			// Don't need to make linkTarget absolute because dfm only ever creates
-			// absolute links so if we got a relative one it's not one of ours.
+			// Relative links made with the relative link strategy are
+			// resolved so they are recognised the same as absolute ones.
+			linkTarget = utils.ResolveLink(path, linkTarget)
 
 			_, err = os.Stat(path)
 			if err != nil && os.IsNotExist(err) {
-				if strings.HasPrefix(linkTarget, targetDir) {
-					fmt.Println("deleting dead link:", path)
-					return os.Remove(path)
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(linkTarget, prefix) {
+						fmt.Println("deleting dead link:", path)
+						return os.Remove(path)
+					}
 				}
 			}
 		}
@@ -50,7 +61,7 @@ var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Clean dead symlinks. Will ignore symlinks unrelated to DFM.",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		home, err := os.UserHomeDir()
+		home, err := targetHome()
 		if err != nil {
 			return err
 		}
@@ -60,12 +71,40 @@ var cleanCmd = &cobra.Command{
 			return err
 		}
 
-		return cleanDeadSymlinks(home, dfmDir)
+		// Profiles are kept outside the dfm directory when the global
+		// config sets profiles_dir.
+		profilesDir, err := state.ProfilesDir()
+		if err != nil {
+			return err
+		}
+
+		modulesDir, err := state.ModulesDir()
+		if err != nil {
+			return err
+		}
+
+		if err := cleanDeadSymlinks(home, dfmDir, profilesDir, modulesDir); err != nil {
+			return err
+		}
+
+		m, err := manifest.Load()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range m.Prune() {
+			logger.Debug().
+				Str("target", entry.Target).
+				Msg("removing link from manifest because dfm no longer owns it")
+		}
+
+		return m.Save()
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(cleanCmd)
+	addTargetFlag(cleanCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -36,3 +36,45 @@ func TestCleanDeadSymlinksRemovesOnlyManagedLinks(t *testing.T) {
 		t.Fatalf("expected unmanaged link to remain, got err=%v", err)
 	}
 }
+
+func TestCleanDeadSymlinksResolvesRelativeLinks(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "home")
+	dfmRoot := filepath.Join(base, "dfm")
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatalf("failed to create root: %v", err)
+	}
+
+	managedLink := filepath.Join(root, "managed")
+	if err := os.Symlink(filepath.Join("..", "dfm", "profiles", "foo"), managedLink); err != nil {
+		t.Fatalf("failed to create managed symlink: %v", err)
+	}
+
+	if err := cleanDeadSymlinks(root, dfmRoot); err != nil {
+		t.Fatalf("cleanDeadSymlinks returned error: %v", err)
+	}
+
+	if _, err := os.Lstat(managedLink); !os.IsNotExist(err) {
+		t.Fatalf("expected relative managed dead link to be removed, got err=%v", err)
+	}
+}
+
+func TestCleanDeadSymlinksChecksEachDirectory(t *testing.T) {
+	root := t.TempDir()
+	dfmRoot := t.TempDir()
+	profilesDir := t.TempDir()
+
+	managedLink := filepath.Join(root, "managed")
+	if err := os.Symlink(filepath.Join(profilesDir, "work", ".bashrc"), managedLink); err != nil {
+		t.Fatalf("failed to create managed symlink: %v", err)
+	}
+
+	if err := cleanDeadSymlinks(root, dfmRoot, profilesDir); err != nil {
+		t.Fatalf("cleanDeadSymlinks returned error: %v", err)
+	}
+
+	if _, err := os.Lstat(managedLink); !os.IsNotExist(err) {
+		t.Fatalf("expected a dead link into the profiles directory to be removed, got err=%v", err)
+	}
+}
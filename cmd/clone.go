@@ -47,7 +47,12 @@ var cloneCmd = &cobra.Command{
 		}
 
 		if link {
-			return profile.Link(overwrite)
+			home, err := targetHome()
+			if err != nil {
+				return err
+			}
+
+			return profile.Link(profiles.LinkOptions{Overwrite: overwriteConflicts(cmd), Home: home})
 		}
 
 		return nil
@@ -70,4 +75,5 @@ func init() {
 		false,
 		"After cloning immediately link the profile",
 	)
+	addTargetFlag(cloneCmd)
 }
@@ -0,0 +1,290 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/chasinglogic/dfm/internal/utils"
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect a profile's .dfm.yml and edit the global config",
+}
+
+const globalConfigHelp = `The global config holds the defaults for every profile, settings in a
+profile's .dfm.yml take precedence over them. It is config.yml in the dfm
+directory of $XDG_CONFIG_HOME. Settings are named by their keys joined with
+dots, such as llm.model.`
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [KEY]",
+	Short: "Print a setting of the global config",
+	Long: `Print a setting of the global config, or all of them without KEY.
+
+` + globalConfigHelp,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			data, err := yaml.Marshal(config.Global)
+			if err != nil {
+				return err
+			}
+
+			fmt.Print(string(data))
+			return nil
+		}
+
+		value, err := config.Global.Get(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <KEY> <VALUE>",
+	Short: "Change a setting of the global config",
+	Long: `Change a setting of the global config.
+
+` + globalConfigHelp,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.Global.Set(args[0], args[1]); err != nil {
+			return err
+		}
+
+		return config.Global.Save()
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <KEY>",
+	Short: "Reset a setting of the global config to its default",
+	Long: `Reset a setting of the global config to its default.
+
+` + globalConfigHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.Global.Unset(args[0]); err != nil {
+			return err
+		}
+
+		return config.Global.Save()
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [PROFILE_NAME]",
+	Short: "Check a profile's .dfm.yml for mistakes",
+	Long: `Check a profile's .dfm.yml for mistakes.
+
+Every mapping, including those of modules, is checked for an invalid match
+regular expression, options which can't be combined, unknown target_os values,
+link strategies and target roots. Hooks are checked for entries which can't be
+run and names dfm never runs. Without a profile name the current profile is
+checked.
+
+Warnings are printed but only errors make the command fail.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := state.State.CurrentProfile
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		location, err := profilePath(name)
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(location, ".dfm.yml")
+		cfg, err := config.Load(file)
+		// Invalid mappings and unknown keys are reported along with
+		// everything else.
+		if err != nil && !isConfigProblem(err) {
+			return err
+		}
+
+		problems := cfg.Validate()
+		errorCount := 0
+		for _, problem := range problems {
+			fmt.Println(problem)
+			if !problem.Warning {
+				errorCount++
+			}
+		}
+
+		if errorCount > 0 {
+			return fmt.Errorf("found %d errors in %s", errorCount, file)
+		}
+
+		if len(problems) == 0 {
+			fmt.Println(file, "is valid")
+		}
+
+		return nil
+	},
+}
+
+var showEffective bool
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [PROFILE_NAME]",
+	Short: "Print a profile's config",
+	Long: `Print a profile's config.
+
+Without --effective the config in .dfm.yml is printed. With --effective the
+config dfm uses is printed, which is .dfm.yml with .dfm.local.yml merged over
+it, each value is followed by a comment naming the file it came from. Without
+a profile name the config of the current profile is printed.`,
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := state.State.CurrentProfile
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		location, err := profilePath(name)
+		if err != nil {
+			return err
+		}
+
+		load := config.LoadCommitted
+		if showEffective {
+			load = config.Load
+		}
+
+		cfg, err := load(filepath.Join(location, ".dfm.yml"))
+		if err != nil && !isConfigProblem(err) {
+			return err
+		}
+
+		var data []byte
+		if showEffective {
+			data, err = cfg.Annotated()
+		} else {
+			data, err = yaml.Marshal(cfg)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var writeMigration bool
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [PROFILE_NAME]",
+	Short: "Upgrade a profile's .dfm.yml to the current config version",
+	Long: fmt.Sprintf(`Upgrade a profile's .dfm.yml to the current config version, %d.
+
+Config files older than the current version are upgraded in memory every time
+they are loaded, this makes the upgrade permanent. Keys which were renamed,
+such as the before_sync hook which is now pre_sync, are renamed in place and
+the version key is set, keeping comments and formatting. The files the profile
+includes and its .dfm.local.yml are upgraded too.
+
+Without --write the changes and the upgraded files are printed. Without a
+profile name the current profile is upgraded.`, config.CurrentVersion),
+	Args: cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := state.State.CurrentProfile
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		location, err := profilePath(name)
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(location, ".dfm.yml")
+		cfg, err := config.Load(file)
+		if err != nil && !isConfigProblem(err) {
+			return err
+		}
+
+		if len(cfg.Outdated()) == 0 {
+			fmt.Println(file, "is up to date")
+			return nil
+		}
+
+		for _, outdated := range cfg.Outdated() {
+			// Files of an extended profile belong to that profile.
+			if rel, err := filepath.Rel(location, outdated.File); err != nil || !filepath.IsLocal(rel) {
+				fmt.Printf("%s: version %d is outdated, migrate the profile it belongs to\n", outdated.File, outdated.From)
+				continue
+			}
+
+			content, err := os.ReadFile(outdated.File)
+			if err != nil {
+				return err
+			}
+
+			migrated, err := config.Migrate(outdated.File, content, true)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s: version %d -> %d\n", migrated.File, migrated.From, migrated.To)
+			for _, change := range migrated.Changes {
+				fmt.Println("  " + change)
+			}
+
+			if !writeMigration {
+				fmt.Printf("\n%s\n", migrated.Content)
+				continue
+			}
+
+			if err := utils.WriteFileAtomic(migrated.File, migrated.Content, 0644); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// isConfigProblem reports whether err from config.Load is only about invalid
+// mappings or unknown keys, in which case the config was still loaded.
+func isConfigProblem(err error) bool {
+	var mappingErr *config.MappingError
+	var unknownErr *config.UnknownKeyError
+	return errors.As(err, &mappingErr) || errors.As(err, &unknownErr)
+}
+
+func init() {
+	configShowCmd.Flags().BoolVar(
+		&showEffective,
+		"effective",
+		false,
+		"Print the config with .dfm.local.yml merged over it and the origin of each value",
+	)
+
+	configMigrateCmd.Flags().BoolVar(
+		&writeMigration,
+		"write",
+		false,
+		"Write the upgraded files instead of printing them",
+	)
+
+	configCmd.AddCommand(configValidateCmd, configShowCmd, configMigrateCmd, configGetCmd, configSetCmd, configUnsetCmd)
+	RootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chasinglogic/dfm/internal/profiles"
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain PATH",
+	Short: "Explain how a file is linked",
+	Long: `Explain how a file is linked.
+
+PATH can be a file in an active profile or one of its modules, or a path in
+HOME which a profile links. The profile or module which owns it is printed
+along with every mapping evaluated for it and its parent directories in order,
+whether each matched and why not, the resulting action and where it is linked
+to. Paths which are skipped, for example because a parent directory is linked
+with link_as_dir, say so.
+
+With more than one active profile the highest layer which owns PATH is
+explained.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stack, err := activeProfiles()
+		if err != nil {
+			return err
+		}
+
+		home, err := targetHome()
+		if err != nil {
+			return err
+		}
+
+		opts := profiles.LinkOptions{Overwrite: true, Home: home}
+		var explanation *profiles.Explanation
+		for idx := len(stack) - 1; idx >= 0 && explanation == nil; idx-- {
+			explanation, err = stack[idx].Explain(args[0], opts)
+			if err != nil && !errors.Is(err, profiles.ErrNotLinked) {
+				return err
+			}
+		}
+
+		if explanation == nil {
+			return fmt.Errorf("%s is not in an active profile or linked by one", args[0])
+		}
+
+		if jsonOutput {
+			data, err := json.MarshalIndent(explanation, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(data))
+			return nil
+		}
+
+		return explanation.WriteText(os.Stdout)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(explainCmd)
+	explainCmd.Flags().BoolVar(
+		&jsonOutput,
+		"json",
+		false,
+		"Print the explanation as JSON",
+	)
+	addTargetFlag(explainCmd)
+}
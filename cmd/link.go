@@ -5,73 +5,302 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/chasinglogic/dfm/internal/config"
 	"github.com/chasinglogic/dfm/internal/profiles"
 	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/spf13/cobra"
 	"github.com/yarlson/pin"
 )
 
-func loadProfile(profilePathOrName string) (*profiles.Profile, error) {
+func profilePath(profilePathOrName string) (string, error) {
 	if profilePathOrName == "" {
-		return nil, errors.New("no current profile is set and no profile name provided")
+		return "", errors.New("no current profile is set and no profile name provided")
 	}
 
 	if filepath.IsAbs(profilePathOrName) {
-		return profiles.Load(profilePathOrName)
+		return profilePathOrName, nil
 	}
 
 	profileDir, err := state.ProfilesDir()
 	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(profileDir, profilePathOrName), nil
+}
+
+// overwriteConflicts reports whether linking replaces conflicting files, which
+// is --overwrite when it is given and the global overwrite setting otherwise.
+func overwriteConflicts(cmd *cobra.Command) bool {
+	if flag := cmd.Flags().Lookup("overwrite"); flag != nil && flag.Changed {
+		return overwrite
+	}
+
+	return config.Global.Overwrite
+}
+
+func loadProfile(profilePathOrName string) (*profiles.Profile, error) {
+	path, err := profilePath(profilePathOrName)
+	if err != nil {
+		return nil, err
+	}
+
+	return profiles.Load(path)
+}
+
+// activeProfiles loads every active profile from the bottom layer to the top.
+func activeProfiles() ([]*profiles.Profile, error) {
+	active := state.State.Active()
+	if len(active) == 0 {
+		_, err := profilePath("")
 		return nil, err
 	}
 
-	return profiles.Load(filepath.Join(profileDir, profilePathOrName))
+	loaded := make([]*profiles.Profile, len(active))
+	for idx, location := range active {
+		profile, err := loadProfile(location)
+		if err != nil {
+			return nil, err
+		}
+
+		loaded[idx] = profile
+	}
+
+	return loaded, nil
+}
+
+// targetDir is the directory to link into instead of the home directory.
+var targetDir string
+
+// addTargetFlag adds the --target flag, which defaults to $DFM_HOME, to cmd.
+func addTargetFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(
+		&targetDir,
+		"target",
+		"t",
+		os.Getenv("DFM_HOME"),
+		"Link into the given directory instead of the home directory, defaults to $DFM_HOME",
+	)
+}
+
+// targetHome returns the directory to link into, the home directory unless
+// --target or $DFM_HOME is set.
+func targetHome() (string, error) {
+	if targetDir != "" {
+		return filepath.Abs(targetDir)
+	}
+
+	return os.UserHomeDir()
+}
+
+var dryRun bool
+var jsonOutput bool
+var noRollback bool
+var adopt bool
+var switchProfile bool
+var layerName string
+
+// linkWithSpinner links layers, ordered from the bottom layer to the top, as
+// one run so that a failure undoes the changes made for all of them.
+func linkWithSpinner(layers []*profiles.Profile, opts profiles.LinkOptions) error {
+	names := make([]string, len(layers))
+	for idx, profile := range layers {
+		names[idx] = filepath.Base(profile.GetLocation())
+	}
+
+	p := pin.New(
+		fmt.Sprintf("Linking %s...", strings.Join(names, ", ")),
+		pin.WithSpinnerColor(pin.ColorCyan),
+		pin.WithWriter(os.Stdout),
+	)
+	if !debugMode {
+		cancel := p.Start(context.Background())
+		defer cancel()
+	}
+
+	if err := profiles.LinkLayers(layers, opts); err != nil {
+		return err
+	}
+
+	if !debugMode {
+		p.Stop("Done!")
+	}
+
+	return nil
+}
+
+// reportLayerConflicts prints the targets which more than one of the given
+// active profiles link. They go to stderr so that the plan printed by
+// --dry-run --json stays valid JSON.
+func reportLayerConflicts(stack []*profiles.Profile, home string) error {
+	if len(stack) < 2 {
+		return nil
+	}
+
+	names := make([]string, len(stack))
+	plans := make([]*profiles.LinkPlan, len(stack))
+	for idx, profile := range stack {
+		// Overwrite so that targets which exist on disk still show up as
+		// claimed by the profile.
+		plan, err := profile.Plan(profiles.LinkOptions{Overwrite: true, Home: home})
+		if err != nil {
+			return err
+		}
+
+		names[idx] = filepath.Base(profile.GetLocation())
+		plans[idx] = plan
+	}
+
+	for _, conflict := range profiles.FindLayerConflicts(names, plans) {
+		fmt.Fprintf(
+			os.Stderr,
+			"%s is linked by %s, using %s\n",
+			conflict.Target,
+			strings.Join(conflict.Layers, ", "),
+			conflict.Layers[len(conflict.Layers)-1],
+		)
+	}
+
+	return nil
 }
 
 // linkCmd represents the link command
 var linkCmd = &cobra.Command{
-	Use:     "link [PROFILE_NAME]",
-	Short:   "Create symlinks in HOME for a dotfile Profile to make it the active profile",
+	Use:   "link [PROFILE_NAME]",
+	Short: "Create symlinks in HOME for a dotfile Profile to make it the active profile",
+	Long: `Create symlinks in HOME for a dotfile Profile to make it the active profile.
+
+With a profile name that profile becomes the only active profile. With --layer
+the profile is linked on top of the already active profiles, where more than
+one active profile links the same file the highest layer wins. Without either
+all of the active profiles are linked again from the bottom layer up.
+
+With --target, or $DFM_HOME, the profiles are linked into another directory
+instead of HOME, for example to try a profile out in a scratch directory. The
+active profiles are left as they are when linking elsewhere.`,
 	Args:    cobra.RangeArgs(0, 1),
 	Aliases: []string{"l"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var profileName string
-		if len(args) > 0 {
-			profileName = args[0]
-		} else {
-			profileName = state.State.CurrentProfile
+		if switchProfile && layerName != "" {
+			return errors.New("--switch and --layer can not be used together")
+		}
+
+		if layerName != "" && len(args) > 0 {
+			return errors.New("--layer can not be used with a profile name argument")
 		}
 
-		profile, err := loadProfile(profileName)
+		// stack is the active profiles once the link has finished and
+		// toLink is the profiles which need to be linked to get there.
+		stack := state.State.Active()
+		toLink := stack
+		switch {
+		case layerName != "":
+			location, err := profilePath(layerName)
+			if err != nil {
+				return err
+			}
+
+			stack = append(slices.DeleteFunc(stack, func(active string) bool {
+				return active == location
+			}), location)
+			toLink = []string{location}
+		case len(args) > 0:
+			location, err := profilePath(args[0])
+			if err != nil {
+				return err
+			}
+
+			stack = []string{location}
+			toLink = stack
+		case len(stack) == 0:
+			_, err := profilePath("")
+			return err
+		}
+
+		home, err := targetHome()
 		if err != nil {
 			return err
 		}
 
-		p := pin.New(
-			fmt.Sprintf("Linking %s...", profileName),
-			pin.WithSpinnerColor(pin.ColorCyan),
-			pin.WithWriter(os.Stdout),
-		)
-		if !debugMode {
-			cancel := p.Start(context.Background())
-			defer cancel()
+		opts := profiles.LinkOptions{
+			Overwrite:  overwriteConflicts(cmd),
+			Adopt:      adopt,
+			NoRollback: noRollback,
+			Home:       home,
 		}
 
-		err = profile.Link(overwrite)
-		if err != nil {
+		if switchProfile {
+			// Only the active profiles which aren't linked again are
+			// switched away from.
+			opts.SwitchFrom = slices.DeleteFunc(state.State.Active(), func(active string) bool {
+				return slices.Contains(stack, active)
+			})
+		}
+
+		layers := make([]*profiles.Profile, len(stack))
+		for idx, location := range stack {
+			profile, err := loadProfile(location)
+			if err != nil {
+				return err
+			}
+
+			layers[idx] = profile
+		}
+
+		if err := reportLayerConflicts(layers, home); err != nil {
+			return err
+		}
+
+		linking := layers[len(layers)-len(toLink):]
+
+		if dryRun {
+			plan := &profiles.LinkPlan{Actions: []profiles.LinkAction{}}
+			for _, profile := range linking {
+				layerPlan, err := profile.Plan(opts)
+				if err != nil {
+					return err
+				}
+
+				plan.Actions = append(plan.Actions, layerPlan.Actions...)
+			}
+
+			if jsonOutput {
+				data, err := json.MarshalIndent(plan, "", "  ")
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(string(data))
+				return nil
+			}
+
+			return plan.WriteText(os.Stdout)
+		}
+
+		// The active profiles only change once every layer is linked, a
+		// failure leaves them as they were.
+		if err := linkWithSpinner(linking, opts); err != nil {
 			return err
 		}
 
-		if !debugMode {
-			p.Stop("Done!")
+		switch {
+		case targetDir != "":
+			// Linking somewhere else doesn't change what is linked in
+			// the home directory.
+		case layerName != "":
+			state.State.PushLayer(stack[len(stack)-1])
+		case len(args) > 0:
+			state.State.SetActive(stack[0])
 		}
 
-		state.State.CurrentProfile = profile.GetLocation()
 		return nil
 	},
 }
@@ -83,6 +312,44 @@ func init() {
 		"overwrite",
 		"o",
 		false,
-		"Delete existing files if they conflict with a link target",
+		"Replace existing files if they conflict with a link target, the replaced files are kept so unlink can restore them. Defaults to the overwrite setting of the global config",
+	)
+	linkCmd.Flags().BoolVar(
+		&adopt,
+		"adopt",
+		false,
+		"Copy changes made to copied files in the home directory back into the profile",
+	)
+	linkCmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"Print what would be linked without changing anything",
+	)
+	linkCmd.Flags().BoolVarP(
+		&switchProfile,
+		"switch",
+		"s",
+		false,
+		"Remove links from the current profile which the new profile does not replace",
+	)
+	linkCmd.Flags().StringVar(
+		&layerName,
+		"layer",
+		"",
+		"Link the given profile on top of the active profiles instead of replacing them",
+	)
+	linkCmd.Flags().BoolVar(
+		&noRollback,
+		"no-rollback",
+		false,
+		"Leave any changes made in place if linking fails instead of undoing them",
+	)
+	linkCmd.Flags().BoolVar(
+		&jsonOutput,
+		"json",
+		false,
+		"With --dry-run print the plan as JSON",
 	)
+	addTargetFlag(linkCmd)
 }
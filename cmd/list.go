@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/spf13/cobra"
@@ -14,7 +15,7 @@ import (
 
 var listCmd = &cobra.Command{
 	Use:     "list",
-	Short:   "List available dotfile profiles",
+	Short:   "List available dotfile profiles and the active profile layers",
 	Aliases: []string{"ls"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		dir, err := state.ProfilesDir()
@@ -27,12 +28,18 @@ var listCmd = &cobra.Command{
 			return err
 		}
 
-		current := filepath.Base(state.State.CurrentProfile)
+		// Active profiles are marked with their layer number, the highest
+		// layer wins when more than one links the same file.
+		active := state.State.Active()
 		for _, entry := range entries {
-			if current == entry.Name() {
-				fmt.Print("* ")
+			layer := slices.IndexFunc(active, func(location string) bool {
+				return filepath.Base(location) == entry.Name()
+			})
+
+			if layer >= 0 {
+				fmt.Printf("* %d ", layer+1)
 			} else {
-				fmt.Print("  ")
+				fmt.Print("    ")
 			}
 
 			fmt.Println(entry.Name())
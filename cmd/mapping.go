@@ -0,0 +1,250 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/profiles"
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var mappingModule string
+var relinkMapping bool
+var newMapping mapping.Mapping
+
+// loadMappingConfig loads the current profile's config along with the config
+// of the module selected with --module, which is the profile's own config
+// without it. Only .dfm.yml is loaded, the machine-local config is left out
+// so that saving never commits it. Invalid mappings and unknown keys are
+// tolerated so that they can be listed and removed.
+func loadMappingConfig() (*config.Config, *config.Config, error) {
+	location, err := profilePath(state.State.CurrentProfile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := config.LoadCommitted(filepath.Join(location, ".dfm.yml"))
+	if err != nil && !isConfigProblem(err) {
+		return nil, nil, err
+	}
+
+	if mappingModule == "" {
+		return cfg, cfg, nil
+	}
+
+	module, err := cfg.Module(mappingModule)
+	return cfg, module, err
+}
+
+// relinkPaths links the paths in the dotfile directory of cfg which m
+// matches, if --link was given.
+func relinkPaths(cfg *config.Config, m *mapping.Mapping) error {
+	if !relinkMapping {
+		return nil
+	}
+
+	paths, err := profiles.MatchingPaths(cfg, m)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+
+	profile, err := loadProfile(state.State.CurrentProfile)
+	if err != nil {
+		return err
+	}
+
+	home, err := targetHome()
+	if err != nil {
+		return err
+	}
+
+	return profile.Link(profiles.LinkOptions{Home: home, Paths: paths})
+}
+
+var mappingCmd = &cobra.Command{
+	Use:   "mapping",
+	Short: "Manage the mappings of the current profile",
+	Long: `Manage the mappings of the current profile.
+
+With --module the mappings of the named module of the current profile are
+managed instead. Only the mappings in .dfm.yml are managed, those in
+.dfm.local.yml are left alone.`,
+}
+
+var mappingListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List the mappings in the order they are checked",
+	Args:    cobra.NoArgs,
+	Aliases: []string{"ls"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, cfg, err := loadMappingConfig()
+		if err != nil {
+			return err
+		}
+
+		for idx, m := range cfg.Mappings {
+			fmt.Printf("%d: %s\n", idx, m.Describe())
+		}
+
+		return nil
+	},
+}
+
+var mappingAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a mapping",
+	Long: `Add a mapping.
+
+The mapping needs one of --match, --glob or --path to select the files it
+applies to and one of --skip, --dest or --link-as-dir to say what it does.
+With --link the files it matches are linked again straight away.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileCfg, cfg, err := loadMappingConfig()
+		if err != nil {
+			return err
+		}
+
+		m := newMapping
+		// Only the new mapping is checked, problems elsewhere are left for
+		// config validate.
+		check := &config.Config{Location: cfg.Location, Mappings: []*mapping.Mapping{&m}}
+		for _, problem := range check.Validate() {
+			if !problem.Warning {
+				return errors.New(problem.Message)
+			}
+		}
+
+		cfg.Mappings = append(cfg.Mappings, &m)
+		if err := profileCfg.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("added mappings[%d]: %s\n", len(cfg.Mappings)-1, m.Describe())
+		return relinkPaths(cfg, &m)
+	},
+}
+
+var mappingRemoveCmd = &cobra.Command{
+	Use:   "remove <INDEX|PATTERN>",
+	Short: "Remove a mapping by its index or its match, glob or path",
+	Long: `Remove a mapping by its index or its match, glob or path.
+
+With --link the files the mapping matched are linked again straight away, any
+of their links which the profile no longer makes are removed.`,
+	Args:    cobra.ExactArgs(1),
+	Aliases: []string{"rm"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileCfg, cfg, err := loadMappingConfig()
+		if err != nil {
+			return err
+		}
+
+		idx, err := cfg.FindMapping(args[0])
+		if err != nil {
+			return err
+		}
+
+		m := cfg.Mappings[idx]
+		cfg.Mappings = append(cfg.Mappings[:idx], cfg.Mappings[idx+1:]...)
+		if err := profileCfg.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("removed mappings[%d]: %s\n", idx, m.Describe())
+		return relinkPaths(cfg, m)
+	},
+}
+
+var mappingTestCmd = &cobra.Command{
+	Use:   "test <PATH>",
+	Short: "Show which mappings match a path in the profile",
+	Long: `Show which mappings match a path in the profile.
+
+PATH is relative to the profile, or the module with --module, unless it is
+absolute. It doesn't need to exist. Linking uses the first mapping which
+matches, the default mappings aren't included, see dfm explain for the full
+picture of how a file is linked.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, cfg, err := loadMappingConfig()
+		if err != nil {
+			return err
+		}
+
+		for idx, m := range cfg.Mappings {
+			if err := m.Compile(); err != nil {
+				return fmt.Errorf("mappings[%d]: %w", idx, err)
+			}
+		}
+
+		results, err := profiles.CheckMappings(cfg, args[0])
+		if err != nil {
+			return err
+		}
+
+		used := -1
+		for _, result := range results {
+			if !result.Matched {
+				fmt.Printf("%d: %s: %s\n", result.Index, result.Mapping.Describe(), result.Reason)
+				continue
+			}
+
+			fmt.Printf("%d: %s: matched, %s\n", result.Index, result.Mapping.Describe(), result.Mapping.Action())
+			if used == -1 {
+				used = result.Index
+			}
+		}
+
+		if used == -1 {
+			fmt.Println("no mapping matches, the path is linked as usual")
+		} else {
+			fmt.Printf("mappings[%d] is used\n", used)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	mappingCmd.PersistentFlags().StringVarP(
+		&mappingModule,
+		"module",
+		"m",
+		"",
+		"Manage the mappings of the module with the given name instead of the profile",
+	)
+
+	for _, cmd := range []*cobra.Command{mappingAddCmd, mappingRemoveCmd} {
+		cmd.Flags().BoolVar(
+			&relinkMapping,
+			"link",
+			false,
+			"Link the files the mapping matches again after changing it",
+		)
+		addTargetFlag(cmd)
+	}
+
+	flags := mappingAddCmd.Flags()
+	flags.StringVar(&newMapping.Match, "match", "", "Regular expression matched against the path of files")
+	flags.StringVar(&newMapping.Glob, "glob", "", "Glob matched against the path of files relative to the profile")
+	flags.StringVar(&newMapping.Path, "path", "", "Exact path of a file or directory relative to the profile")
+	flags.BoolVar(&newMapping.Skip, "skip", false, "Don't link matching files")
+	flags.StringVar(&newMapping.Dest, "dest", "", "Link matching files to this path instead")
+	flags.BoolVar(&newMapping.LinkAsDir, "link-as-dir", false, "Link the matching directory itself instead of its files")
+	flags.StringVar(&newMapping.TargetOS, "os", "", "Only apply the mapping on this operating system")
+	mappingAddCmd.MarkFlagsOneRequired("match", "glob", "path")
+	mappingAddCmd.MarkFlagsMutuallyExclusive("match", "glob", "path")
+	mappingAddCmd.MarkFlagsOneRequired("skip", "dest", "link-as-dir")
+	mappingAddCmd.MarkFlagsMutuallyExclusive("skip", "dest", "link-as-dir")
+
+	mappingCmd.AddCommand(mappingListCmd, mappingAddCmd, mappingRemoveCmd, mappingTestCmd)
+	RootCmd.AddCommand(mappingCmd)
+}
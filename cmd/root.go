@@ -4,9 +4,12 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"time"
 
+	"github.com/chasinglogic/dfm/internal/config"
 	"github.com/chasinglogic/dfm/internal/logger"
 	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/rs/zerolog"
@@ -35,6 +38,23 @@ var RootCmd = &cobra.Command{
 			).With().Timestamp().Logger(),
 		)
 
+		if err := config.LoadGlobal(); err != nil {
+			var unknownErr *config.UnknownKeyError
+			if cmd.Parent() != configCmd || !errors.As(err, &unknownErr) {
+				return err
+			}
+
+			// The config commands are how a global config with unknown
+			// keys gets fixed, so they only warn about them.
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+
+		profilesDir, err := config.Global.ProfilesPath()
+		if err != nil {
+			return err
+		}
+
+		state.ProfilesLocation = profilesDir
 		return state.Load()
 	},
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
@@ -50,4 +70,10 @@ func init() {
 		os.Getenv("DFM_DEBUG") != "",
 		"Turn on debug logging",
 	)
+	RootCmd.PersistentFlags().BoolVar(
+		&config.Lenient,
+		"lenient",
+		os.Getenv("DFM_LENIENT") != "",
+		"Ignore unknown keys in .dfm.yml, such as those of newer versions of dfm",
+	)
 }
@@ -4,15 +4,34 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/chasinglogic/dfm/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var statusCmd = &cobra.Command{
 	Use:     "status",
-	Short:   "Print the git status of the current dotfile profile",
+	Short:   "Print the git status of the active dotfile profiles",
 	Aliases: []string{"st"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return gitCmd.RunE(cmd, []string{"status"})
+		active, err := activeProfiles()
+		if err != nil {
+			return err
+		}
+
+		for idx, profile := range active {
+			if idx > 0 {
+				fmt.Println("")
+			}
+
+			fmt.Println("#", profile.GetLocation())
+			if err := utils.RunIn(profile.GetLocation(), "git", "status"); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	},
 }
 
@@ -4,16 +4,15 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/spf13/cobra"
 )
 
 var syncCmd = &cobra.Command{
 	Use:     "sync",
-	Short:   "Sync your dotfiles with git",
+	Short:   "Sync your active dotfile profiles with git",
 	Aliases: []string{"s"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		profile, err := loadProfile(state.State.CurrentProfile)
+		active, err := activeProfiles()
 		if err != nil {
 			return err
 		}
@@ -23,7 +22,13 @@ var syncCmd = &cobra.Command{
 			return err
 		}
 
-		return profile.Sync(commitMessage)
+		for _, profile := range active {
+			if err := profile.Sync(commitMessage); err != nil {
+				return err
+			}
+		}
+
+		return nil
 	},
 }
 
@@ -0,0 +1,116 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/chasinglogic/dfm/internal/profiles"
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/spf13/cobra"
+)
+
+var unlinkCmd = &cobra.Command{
+	Use:   "unlink [PROFILE_NAME]",
+	Short: "Remove the links created for a profile and restore the files they replaced",
+	Args:  cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName := state.State.CurrentProfile
+		if len(args) > 0 {
+			profileName = args[0]
+		}
+
+		location, err := profilePath(profileName)
+		if err != nil {
+			return err
+		}
+
+		// The targets the active layers under the profile also link are
+		// handed back to them first, so that a failure leaves the profile
+		// linked as it was.
+		if slices.Contains(state.State.Active(), location) {
+			if err := relinkLayers(location); err != nil {
+				return err
+			}
+		}
+
+		m, err := manifest.Load()
+		if err != nil {
+			return err
+		}
+
+		result, unlinkErr := profiles.Unlink(m, location)
+		if unlinkErr == nil {
+			state.State.Deactivate(location)
+		}
+
+		// The manifest and the active profiles are saved together, even
+		// when unlinking failed, so that they agree on what is linked.
+		if err := errors.Join(m.Save(), state.Save()); err != nil {
+			return errors.Join(unlinkErr, err)
+		}
+
+		for _, entry := range result.Removed {
+			fmt.Println("removed link:", entry.Target)
+		}
+
+		for _, entry := range result.Restored {
+			fmt.Println("restored:", entry.Target)
+		}
+
+		for _, entry := range result.Refused {
+			fmt.Println("skipped, link was changed since dfm created it:", entry.Target)
+		}
+
+		return unlinkErr
+	},
+}
+
+// relinkLayers links the files of the other active profiles which link the
+// targets of the profile at location, so that the layers under it take them
+// back before it is unlinked.
+func relinkLayers(location string) error {
+	remaining := slices.DeleteFunc(state.State.Active(), func(active string) bool {
+		return active == location
+	})
+
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	layers := make([]*profiles.Profile, len(remaining))
+	for idx, active := range remaining {
+		profile, err := loadProfile(active)
+		if err != nil {
+			return err
+		}
+
+		layers[idx] = profile
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		return err
+	}
+
+	targets := map[string][]string{}
+	for _, entry := range m.ForProfile(location) {
+		targets[entry.Home] = append(targets[entry.Home], entry.Target)
+	}
+
+	for home, homeTargets := range targets {
+		if err := profiles.RelinkTargets(layers, home, homeTargets); err != nil {
+			return fmt.Errorf("failed to link the layers under the profile again: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(unlinkCmd)
+}
@@ -6,25 +6,43 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/chasinglogic/dfm/internal/state"
 	"github.com/spf13/cobra"
 )
 
+var whereAll bool
+
 var whereCmd = &cobra.Command{
 	Use:     "where",
 	Aliases: []string{"w"},
 	Short:   "Prints the location of the current dotfile profile",
+	Long: `Prints the location of the current dotfile profile, the top layer when more
+than one profile is active. With --all the location of every active profile is
+printed, one per line from the bottom layer to the top.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		profile, err := loadProfile(state.State.CurrentProfile)
+		active, err := activeProfiles()
 		if err != nil {
 			return err
 		}
 
-		fmt.Println(profile.GetLocation())
+		if !whereAll {
+			active = active[len(active)-1:]
+		}
+
+		for _, profile := range active {
+			fmt.Println(profile.GetLocation())
+		}
+
 		return nil
 	},
 }
 
 func init() {
 	RootCmd.AddCommand(whereCmd)
+	whereCmd.Flags().BoolVarP(
+		&whereAll,
+		"all",
+		"a",
+		false,
+		"Print the location of every active profile from the bottom layer to the top",
+	)
 }
@@ -3,6 +3,7 @@ module github.com/chasinglogic/dfm
 go 1.26.1
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.10.2
 	github.com/chzyer/readline v1.5.1
 	github.com/goccy/go-yaml v1.18.0
 	github.com/google/generative-ai-go v0.20.1
@@ -0,0 +1,368 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+var counter atomic.Uint64
+
+// Backup is a file or directory dfm moved out of the way instead of deleting
+// it.
+type Backup struct {
+	ID        string    `json:"id"`
+	Original  string    `json:"original"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Index lists every backup in the store, oldest first.
+type Index struct {
+	Backups []Backup `json:"backups"`
+}
+
+// Retention controls which backups Prune removes. A zero value for either
+// field means no limit.
+type Retention struct {
+	// Keep is the number of most recent backups to keep.
+	Keep int
+	// MaxAge is how long to keep a backup for.
+	MaxAge time.Duration
+}
+
+// storeDir returns the directory of the backup store. Backups made when the
+// store was in the dfm cache directory are moved to it first.
+func storeDir() (string, error) {
+	dir, err := state.BackupsDir()
+	if err != nil {
+		return "", err
+	}
+
+	legacy, err := state.LegacyBackupsDir()
+	if err != nil {
+		return "", err
+	}
+
+	if legacy == dir {
+		return dir, nil
+	}
+
+	return dir, moveLegacyStore(legacy, dir)
+}
+
+// moveLegacyStore moves the backups in legacy into dir, unless dir already
+// has backups of its own, and points the index at their new location.
+func moveLegacyStore(legacy, dir string) error {
+	legacyIndex := filepath.Join(legacy, "index.json")
+	if _, err := os.Stat(legacyIndex); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return fmt.Errorf("backups exist in both %s and %s, move those in %s by hand", legacy, dir, legacy)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	content, err := os.ReadFile(legacyIndex)
+	if err != nil {
+		return err
+	}
+
+	index := &Index{Backups: []Backup{}}
+	if err := json.Unmarshal(content, index); err != nil {
+		return err
+	}
+
+	// The store directory was created empty, the legacy store takes its
+	// place.
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+
+	if err := move(legacy, dir); err != nil {
+		return err
+	}
+
+	for idx, b := range index.Backups {
+		if rel, err := filepath.Rel(legacy, b.Path); err == nil && filepath.IsLocal(rel) {
+			index.Backups[idx].Path = filepath.Join(dir, rel)
+		}
+	}
+
+	content, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(filepath.Join(dir, "index.json"), content, 0644)
+}
+
+func indexFile() (string, error) {
+	dir, err := storeDir()
+	return filepath.Join(dir, "index.json"), err
+}
+
+func LoadIndex() (*Index, error) {
+	index := &Index{Backups: []Backup{}}
+
+	file, err := indexFile()
+	if err != nil {
+		return index, err
+	}
+
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return index, err
+	}
+
+	return index, json.Unmarshal(content, index)
+}
+
+func (i *Index) Save() error {
+	content, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := indexFile()
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(file, content, 0644)
+}
+
+func (i *Index) Get(id string) (Backup, bool) {
+	for _, b := range i.Backups {
+		if b.ID == id {
+			return b, true
+		}
+	}
+
+	return Backup{}, false
+}
+
+// Find returns the backup with the given ID or, if there is none, the most
+// recent backup of the given original path.
+func (i *Index) Find(idOrPath string) (Backup, error) {
+	if b, ok := i.Get(idOrPath); ok {
+		return b, nil
+	}
+
+	original, err := filepath.Abs(idOrPath)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	for idx := len(i.Backups) - 1; idx >= 0; idx-- {
+		if i.Backups[idx].Original == original {
+			return i.Backups[idx], nil
+		}
+	}
+
+	return Backup{}, fmt.Errorf("no backup with ID or original path %s", idOrPath)
+}
+
+func (i *Index) remove(id string) {
+	i.Backups = slices.DeleteFunc(i.Backups, func(b Backup) bool {
+		return b.ID == id
+	})
+}
+
+// Move moves path into the backup store instead of deleting it and records it
+// in the index.
+func Move(path string) (Backup, error) {
+	dir, err := storeDir()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	now := time.Now().UTC()
+	id := fmt.Sprintf("%s-%d", now.Format("20060102T150405.000000000"), counter.Add(1))
+
+	original, err := filepath.Abs(path)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	b := Backup{
+		ID:        id,
+		Original:  original,
+		Path:      filepath.Join(dir, id, filepath.Base(path)),
+		CreatedAt: now,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0744); err != nil {
+		return b, err
+	}
+
+	if err := move(path, b.Path); err != nil {
+		return b, err
+	}
+
+	index.Backups = append(index.Backups, b)
+	return b, index.Save()
+}
+
+// Restore moves the backup with the given ID back to where it came from. It
+// refuses to replace anything which exists there now.
+func Restore(id string) (Backup, error) {
+	index, err := LoadIndex()
+	if err != nil {
+		return Backup{}, err
+	}
+
+	b, ok := index.Get(id)
+	if !ok {
+		return b, fmt.Errorf("no backup with ID %s", id)
+	}
+
+	if _, err := os.Lstat(b.Original); err == nil {
+		return b, fmt.Errorf("refusing to restore %s because something already exists there", b.Original)
+	} else if !os.IsNotExist(err) {
+		return b, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.Original), 0744); err != nil {
+		return b, err
+	}
+
+	if err := move(b.Path, b.Original); err != nil {
+		return b, err
+	}
+
+	// Clean up the now empty directory which held the backup.
+	_ = os.Remove(filepath.Dir(b.Path))
+
+	index.remove(b.ID)
+	return b, index.Save()
+}
+
+// Prune deletes backups which fall outside of the retention policy. Backups
+// whose ID is in protected are always kept.
+func Prune(retention Retention, protected map[string]bool) ([]Backup, error) {
+	index, err := LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []Backup{}
+	kept := 0
+	now := time.Now().UTC()
+	for idx := len(index.Backups) - 1; idx >= 0; idx-- {
+		b := index.Backups[idx]
+		if protected[b.ID] {
+			continue
+		}
+
+		tooMany := retention.Keep > 0 && kept >= retention.Keep
+		tooOld := retention.MaxAge > 0 && now.Sub(b.CreatedAt) > retention.MaxAge
+		if !tooMany && !tooOld {
+			kept++
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Dir(b.Path)); err != nil {
+			return pruned, err
+		}
+
+		pruned = append(pruned, b)
+	}
+
+	for _, b := range pruned {
+		index.remove(b.ID)
+	}
+
+	return pruned, index.Save()
+}
+
+// move renames src to dst falling back to copying when they are on
+// different filesystems.
+func move(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveAndRestore(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	original := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(original, []byte("data"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := Move(original)
+	if err != nil {
+		t.Fatalf("Move returned error: %v", err)
+	}
+
+	if _, err := os.Lstat(original); !os.IsNotExist(err) {
+		t.Fatalf("expected original to be moved, got err=%v", err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+
+	found, err := index.Find(original)
+	if err != nil {
+		t.Fatalf("Find by original path returned error: %v", err)
+	}
+
+	if found.ID != b.ID {
+		t.Fatalf("Find returned %q, want %q", found.ID, b.ID)
+	}
+
+	if err := os.WriteFile(original, []byte("new"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := Restore(b.ID); err == nil {
+		t.Fatal("expected Restore to refuse to replace an existing file")
+	}
+
+	if err := os.Remove(original); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+
+	if _, err := Restore(b.ID); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(original)
+	if err != nil {
+		t.Fatalf("failed to read restored file: %v", err)
+	}
+
+	if string(content) != "data" {
+		t.Fatalf("restored content = %q, want %q", content, "data")
+	}
+
+	index, err = LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+
+	if len(index.Backups) != 0 {
+		t.Fatalf("expected restored backup to be removed from the index, got %+v", index.Backups)
+	}
+}
+
+func TestLegacyStoreIsMoved(t *testing.T) {
+	cacheHome := t.TempDir()
+	stateHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	original := filepath.Join(t.TempDir(), "config")
+	legacy := filepath.Join(cacheHome, "dfm", "backups")
+	b := Backup{ID: "legacy-1", Original: original, Path: filepath.Join(legacy, "legacy-1", "config")}
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+		t.Fatalf("failed to create legacy store: %v", err)
+	}
+
+	if err := os.WriteFile(b.Path, []byte("data"), 0600); err != nil {
+		t.Fatalf("failed to write backup: %v", err)
+	}
+
+	content, err := json.Marshal(Index{Backups: []Backup{b}})
+	if err != nil {
+		t.Fatalf("failed to marshal index: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(legacy, "index.json"), content, 0644); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+
+	want := filepath.Join(stateHome, "dfm", "backups", "legacy-1", "config")
+	if moved, ok := index.Get(b.ID); !ok || moved.Path != want {
+		t.Fatalf("expected the backup to be moved to %s, got %+v", want, moved)
+	}
+
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("expected the legacy store to be gone, got %v", err)
+	}
+
+	if _, err := Restore(b.ID); err != nil {
+		t.Fatalf("Restore returned error: %v", err)
+	}
+
+	if content, err := os.ReadFile(original); err != nil || string(content) != "data" {
+		t.Fatalf("expected the moved backup to be restored, got %q, %v", content, err)
+	}
+}
+
+func TestPruneAppliesRetention(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	backups := []Backup{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		b, err := Move(path)
+		if err != nil {
+			t.Fatalf("Move returned error: %v", err)
+		}
+
+		backups = append(backups, b)
+	}
+
+	index, err := LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+
+	// Age the oldest backup so only MaxAge applies to it.
+	index.Backups[0].CreatedAt = time.Now().Add(-48 * time.Hour)
+	if err := index.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	pruned, err := Prune(Retention{MaxAge: 24 * time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+
+	if len(pruned) != 1 || pruned[0].ID != backups[0].ID {
+		t.Fatalf("expected only the old backup to be pruned, got %+v", pruned)
+	}
+
+	pruned, err = Prune(Retention{Keep: 1}, map[string]bool{backups[1].ID: true})
+	if err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+
+	if len(pruned) != 1 || pruned[0].ID != backups[2].ID {
+		t.Fatalf("expected the unprotected older backup to be pruned, got %+v", pruned)
+	}
+
+	if _, err := os.Stat(backups[2].Path); !os.IsNotExist(err) {
+		t.Fatalf("expected pruned backup to be deleted, got err=%v", err)
+	}
+
+	index, err = LoadIndex()
+	if err != nil {
+		t.Fatalf("LoadIndex returned error: %v", err)
+	}
+
+	if len(index.Backups) != 2 {
+		t.Fatalf("expected 2 backups to remain, got %+v", index.Backups)
+	}
+}
+
+func TestCopyTreePreservesStructure(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "copy")
+
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0755); err != nil {
+		t.Fatalf("failed to create dirs: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "nested", "file"), []byte("data"), 0640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := os.Symlink("file", filepath.Join(src, "nested", "link")); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree returned error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "nested", "file"))
+	if err != nil {
+		t.Fatalf("expected file to be copied: %v", err)
+	}
+
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("copied file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+
+	link, err := os.Readlink(filepath.Join(dst, "nested", "link"))
+	if err != nil || link != "file" {
+		t.Fatalf("expected symlink to be copied, got %q err=%v", link, err)
+	}
+}
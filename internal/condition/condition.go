@@ -0,0 +1,437 @@
+// Package condition decides whether parts of a profile, such as mappings,
+// modules and hooks, apply to the machine dfm is running on.
+package condition
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// KnownOS are the values the os condition, and a mapping's target_os, can
+// match. They are the operating systems Go can be built for.
+var KnownOS = []string{
+	"aix",
+	"android",
+	"darwin",
+	"dragonfly",
+	"freebsd",
+	"illumos",
+	"ios",
+	"js",
+	"linux",
+	"netbsd",
+	"openbsd",
+	"plan9",
+	"solaris",
+	"wasip1",
+	"windows",
+}
+
+// KnownArch are the values the arch condition can match, they are the
+// architectures Go can be built for.
+var KnownArch = []string{
+	"386",
+	"amd64",
+	"arm",
+	"arm64",
+	"loong64",
+	"mips",
+	"mips64",
+	"mips64le",
+	"mipsle",
+	"ppc64",
+	"ppc64le",
+	"riscv64",
+	"s390x",
+	"wasm",
+}
+
+// List is a condition value which can be written in YAML as a single string
+// or a list of them. Entries starting with ! are negated.
+type List []string
+
+// CheckQuoting returns an error for the first value in content, a YAML
+// document such as a .dfm.yml, which starts with ! but isn't quoted. YAML
+// reads such values as tags, which either fail to parse or are dropped. Under
+// a when key they are negated condition values, elsewhere they are most
+// likely meant as plain strings too.
+func CheckQuoting(content []byte) error {
+	tokens := lexer.Tokenize(string(content))
+
+	// whenKey is the when key whose block the tokens are in, nil outside
+	// of one.
+	var whenKey *token.Token
+	for idx, tk := range tokens {
+		if tk.Type == token.CommentType {
+			continue
+		}
+
+		if whenKey != nil && tk.Position.Line > whenKey.Position.Line && tk.Position.Column <= whenKey.Position.Column {
+			whenKey = nil
+		}
+
+		if whenKey == nil && tk.Value == "when" && idx+1 < len(tokens) && tokens[idx+1].Type == token.MappingValueType {
+			whenKey = tk
+			continue
+		}
+
+		if tk.Type != token.TagType || strings.HasPrefix(tk.Value, "!!") {
+			continue
+		}
+
+		// In a flow sequence the tag runs on to the end of it.
+		value, _, _ := strings.Cut(tk.Value, ",")
+		value = strings.TrimRight(value, "]} ")
+		if whenKey == nil {
+			return fmt.Errorf("line %d: values starting with ! must be quoted, write %q instead of %s", tk.Position.Line, value, value)
+		}
+
+		return fmt.Errorf("line %d: %w", tk.Position.Line, unquotedError(value))
+	}
+
+	return nil
+}
+
+func unquotedError(value string) error {
+	return fmt.Errorf("negated condition values must be quoted, write %q instead of %s", value, value)
+}
+
+// UnmarshalYAML decodes a List from the raw YAML so that negated entries
+// which weren't quoted, and so were read as tags, are reported rather than
+// silently dropped.
+func (l *List) UnmarshalYAML(data []byte) error {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		*l = List{}
+		return nil
+	}
+
+	body := file.Docs[0].Body
+	nodes := []ast.Node{body}
+	if seq, ok := body.(*ast.SequenceNode); ok {
+		nodes = seq.Values
+	}
+
+	list := make(List, 0, len(nodes))
+	for _, node := range nodes {
+		entry, err := listEntry(node)
+		if err != nil {
+			return err
+		}
+
+		list = append(list, entry)
+	}
+
+	*l = list
+	return nil
+}
+
+// listEntry returns the string value of a scalar node.
+func listEntry(node ast.Node) (string, error) {
+	switch n := node.(type) {
+	case *ast.TagNode:
+		return "", unquotedError(n.Start.Value)
+	case *ast.NullNode:
+		return "", errors.New(`condition values can not be empty, quote negated values such as "!darwin"`)
+	case ast.ScalarNode:
+		if token := n.GetToken(); token != nil {
+			return token.Value, nil
+		}
+	}
+
+	return "", errors.New("condition must be a string or a list of strings")
+}
+
+// split returns the entries of l which are not negated and those which are,
+// without the !.
+func (l List) split() ([]string, []string) {
+	positive, negative := []string{}, []string{}
+	for _, entry := range l {
+		if negated, ok := strings.CutPrefix(entry, "!"); ok {
+			negative = append(negative, negated)
+		} else {
+			positive = append(positive, entry)
+		}
+	}
+
+	return positive, negative
+}
+
+// anyOf reports whether the values of a fact satisfy l. Some value must
+// match one of the entries of l, if it has any which aren't negated, and no
+// value may match a negated entry.
+func (l List) anyOf(values []string, match func(entry, value string) bool) bool {
+	positive, negative := l.split()
+	matchesAny := func(entries []string) bool {
+		for _, entry := range entries {
+			for _, value := range values {
+				if match(entry, value) {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	if len(positive) > 0 && !matchesAny(positive) {
+		return false
+	}
+
+	return !matchesAny(negative)
+}
+
+// Condition is the when block of a mapping, module or hook. Every condition
+// which is set must hold for it to match, an empty Condition always matches.
+type Condition struct {
+	// OS matches runtime.GOOS.
+	OS List `yaml:"os,omitempty"`
+	// Arch matches runtime.GOARCH.
+	Arch List `yaml:"arch,omitempty"`
+	// Hostname matches the hostname with globs.
+	Hostname List `yaml:"hostname,omitempty"`
+	// Distro matches the ID, or any of the ID_LIKE values, in
+	// /etc/os-release.
+	Distro List `yaml:"distro,omitempty"`
+	// Env holds for each entry: NAME requires the variable to be set,
+	// NAME=value requires it to be equal to value and a leading ! negates
+	// either.
+	Env List `yaml:"env,omitempty"`
+	// Command requires each entry to be an executable on PATH, or not to be
+	// with a leading !.
+	Command List `yaml:"command,omitempty"`
+}
+
+// Facts describes the machine conditions are evaluated against.
+type Facts struct {
+	OS       string
+	Arch     string
+	Hostname string
+	// Distro is the ID from /etc/os-release followed by its ID_LIKE
+	// values, it is empty on systems without one.
+	Distro    []string
+	LookupEnv func(name string) (string, bool)
+	LookPath  func(file string) (string, error)
+}
+
+// Current returns the facts for the machine dfm is running on, they are
+// gathered once.
+var Current = sync.OnceValue(func() Facts {
+	hostname, _ := os.Hostname()
+	return Facts{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Hostname:  hostname,
+		Distro:    readDistro("/etc/os-release"),
+		LookupEnv: os.LookupEnv,
+		LookPath:  exec.LookPath,
+	}
+})
+
+// readDistro returns the ID and ID_LIKE values from the os-release file at
+// file, or nil if there isn't one.
+func readDistro(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	id, like := []string{}, []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			id = append(id, value)
+		case "ID_LIKE":
+			like = append(like, strings.Fields(value)...)
+		}
+	}
+
+	return append(id, like...)
+}
+
+// Matches reports whether c holds on the machine dfm is running on. A nil
+// Condition always matches.
+func (c *Condition) Matches() bool {
+	return c.MatchesFacts(Current())
+}
+
+// MatchesFacts reports whether c holds for the machine described by f.
+func (c *Condition) MatchesFacts(f Facts) bool {
+	return c.MismatchFacts(f) == ""
+}
+
+// Mismatch describes the first part of c which does not hold on the machine
+// dfm is running on, it returns "" if c matches.
+func (c *Condition) Mismatch() string {
+	return c.MismatchFacts(Current())
+}
+
+// MismatchFacts describes the first part of c which does not hold for the
+// machine described by f, it returns "" if c matches.
+func (c *Condition) MismatchFacts(f Facts) string {
+	if c == nil {
+		return ""
+	}
+
+	equalFold := func(entry, value string) bool {
+		return strings.EqualFold(entry, value)
+	}
+
+	globMatch := func(entry, value string) bool {
+		matched, err := path.Match(strings.ToLower(entry), strings.ToLower(value))
+		return err == nil && matched
+	}
+
+	lists := []struct {
+		name   string
+		list   List
+		values []string
+		match  func(entry, value string) bool
+	}{
+		{"os", c.OS, []string{f.OS}, equalFold},
+		{"arch", c.Arch, []string{f.Arch}, equalFold},
+		{"hostname", c.Hostname, []string{f.Hostname}, globMatch},
+		{"distro", c.Distro, f.Distro, equalFold},
+	}
+
+	for _, l := range lists {
+		if !l.list.anyOf(l.values, l.match) {
+			return fmt.Sprintf(
+				"%s %q does not match %s",
+				l.name,
+				strings.Join(l.values, " "),
+				strings.Join(l.list, ", "),
+			)
+		}
+	}
+
+	if entry, ok := c.envMismatch(f); ok {
+		return fmt.Sprintf("env %s does not hold", entry)
+	}
+
+	if entry, ok := c.commandMismatch(f); ok {
+		if negated, ok := strings.CutPrefix(entry, "!"); ok {
+			return fmt.Sprintf("command %s is on PATH", negated)
+		}
+
+		return fmt.Sprintf("command %s is not on PATH", entry)
+	}
+
+	return ""
+}
+
+// envMismatch returns the first env entry which does not hold.
+func (c *Condition) envMismatch(f Facts) (string, bool) {
+	for _, original := range c.Env {
+		entry, negated := strings.CutPrefix(original, "!")
+		name, want, compare := strings.Cut(entry, "=")
+		value, set := f.LookupEnv(name)
+
+		holds := set
+		if compare {
+			holds = set && value == want
+		}
+
+		if holds == negated {
+			return original, true
+		}
+	}
+
+	return "", false
+}
+
+// commandMismatch returns the first command entry which does not hold.
+func (c *Condition) commandMismatch(f Facts) (string, bool) {
+	for _, original := range c.Command {
+		entry, negated := strings.CutPrefix(original, "!")
+		_, err := f.LookPath(entry)
+		if (err == nil) == negated {
+			return original, true
+		}
+	}
+
+	return "", false
+}
+
+// Validate returns an error describing the first value of c which can never
+// match.
+func (c *Condition) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	known := func(name string, list List, values []string) error {
+		for _, entry := range list {
+			value := strings.TrimPrefix(entry, "!")
+			if !slices.Contains(values, strings.ToLower(value)) {
+				return fmt.Errorf("unknown %s %q, must be one of %s", name, value, strings.Join(values, ", "))
+			}
+		}
+
+		return nil
+	}
+
+	if err := known("os", c.OS, KnownOS); err != nil {
+		return err
+	}
+
+	if err := known("arch", c.Arch, KnownArch); err != nil {
+		return err
+	}
+
+	for _, entry := range c.Hostname {
+		if _, err := path.Match(strings.TrimPrefix(entry, "!"), ""); err != nil {
+			return fmt.Errorf("invalid hostname glob %q: %w", entry, err)
+		}
+	}
+
+	for _, entry := range slices.Concat(c.Env, c.Command, c.Distro) {
+		if strings.TrimPrefix(entry, "!") == "" {
+			return errors.New("condition values can not be empty")
+		}
+	}
+
+	return nil
+}
+
+// FromValue decodes a Condition from a value decoded from YAML without a
+// type, such as the when key of a hook.
+func FromValue(value any) (*Condition, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Condition{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,203 @@
+package condition
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func testFacts() Facts {
+	env := map[string]string{"EDITOR": "vim", "EMPTY": ""}
+	commands := []string{"git", "make"}
+
+	return Facts{
+		OS:       "linux",
+		Arch:     "amd64",
+		Hostname: "work-laptop",
+		Distro:   []string{"ubuntu", "debian"},
+		LookupEnv: func(name string) (string, bool) {
+			value, ok := env[name]
+			return value, ok
+		},
+		LookPath: func(file string) (string, error) {
+			if slices.Contains(commands, file) {
+				return "/usr/bin/" + file, nil
+			}
+
+			return "", errors.New("not found")
+		},
+	}
+}
+
+func TestMatchesFacts(t *testing.T) {
+	cases := map[string]struct {
+		condition *Condition
+		expected  bool
+	}{
+		"nil":                     {nil, true},
+		"empty":                   {&Condition{}, true},
+		"os":                      {&Condition{OS: List{"Linux"}}, true},
+		"os mismatch":             {&Condition{OS: List{"darwin"}}, false},
+		"os list":                 {&Condition{OS: List{"darwin", "linux"}}, true},
+		"os negated":              {&Condition{OS: List{"!linux"}}, false},
+		"os only negated":         {&Condition{OS: List{"!windows"}}, true},
+		"os positive and negated": {&Condition{OS: List{"linux", "!darwin"}}, true},
+		"arch":                    {&Condition{Arch: List{"arm64"}}, false},
+		"hostname glob":           {&Condition{Hostname: List{"work-*"}}, true},
+		"hostname negated glob":   {&Condition{Hostname: List{"!WORK-*"}}, false},
+		"distro id":               {&Condition{Distro: List{"ubuntu"}}, true},
+		"distro id like":          {&Condition{Distro: List{"debian"}}, true},
+		"distro mismatch":         {&Condition{Distro: List{"fedora"}}, false},
+		"env set":                 {&Condition{Env: List{"EMPTY"}}, true},
+		"env unset":               {&Condition{Env: List{"DISPLAY"}}, false},
+		"env negated":             {&Condition{Env: List{"!DISPLAY"}}, true},
+		"env equal":               {&Condition{Env: List{"EDITOR=vim"}}, true},
+		"env not equal":           {&Condition{Env: List{"EDITOR=emacs"}}, false},
+		"env negated equal":       {&Condition{Env: List{"!EDITOR=emacs"}}, true},
+		"env all must hold":       {&Condition{Env: List{"EDITOR", "DISPLAY"}}, false},
+		"command":                 {&Condition{Command: List{"git"}}, true},
+		"command missing":         {&Condition{Command: List{"git", "docker"}}, false},
+		"command negated":         {&Condition{Command: List{"!docker"}}, true},
+		"every condition":         {&Condition{OS: List{"linux"}, Command: List{"docker"}}, false},
+	}
+
+	for name, tc := range cases {
+		if got := tc.condition.MatchesFacts(testFacts()); got != tc.expected {
+			t.Fatalf("%s: MatchesFacts = %v, want %v", name, got, tc.expected)
+		}
+	}
+}
+
+func TestUnmarshalList(t *testing.T) {
+	cases := map[string]List{
+		"os: linux\n":                         {"linux"},
+		"os: [linux, \"!darwin\"]\n":          {"linux", "!darwin"},
+		"os: ['!darwin', linux]\n":            {"!darwin", "linux"},
+		"os:\n  - linux\n  - \"!darwin\"\n":   {"linux", "!darwin"},
+		"os: \"!windows\"\n":                  {"!windows"},
+		"arch: 386\n":                         {"386"},
+		"env:\n  - \"!CI\"\n  - EDITOR=vim\n": {"!CI", "EDITOR=vim"},
+	}
+
+	for content, want := range cases {
+		c := Condition{}
+		if err := yaml.Unmarshal([]byte(content), &c); err != nil {
+			t.Fatalf("Unmarshal(%q) returned error: %v", content, err)
+		}
+
+		got := slices.Concat(c.OS, c.Arch, c.Env)
+		if !slices.Equal(got, want) {
+			t.Fatalf("Unmarshal(%q) = %q, want %q", content, got, want)
+		}
+	}
+
+	for _, content := range []string{"os: {linux: true}\n", "os: [linux, ~]\n"} {
+		c := Condition{}
+		if err := yaml.Unmarshal([]byte(content), &c); err == nil {
+			t.Fatalf("expected Unmarshal(%q) to return an error", content)
+		}
+	}
+}
+
+func TestUnquotedNegationsAreRejected(t *testing.T) {
+	unquoted := []string{
+		"os: [linux, !darwin]\n",
+		"os: [!darwin, linux]\n",
+		"os:\n  - !darwin\n  - linux\n",
+		"os:\n  - linux\n  - !darwin\n",
+		"os: !darwin\n",
+	}
+
+	for _, content := range unquoted {
+		for _, config := range []string{
+			"when:\n" + indent(content, "  "),
+			"modules:\n  - repository: work\n    when:\n" + indent(content, "      ") + "    link: post\n",
+		} {
+			err := CheckQuoting([]byte(config))
+			if err == nil || !strings.Contains(err.Error(), `negated condition values must be quoted, write "!darwin"`) {
+				t.Fatalf("CheckQuoting(%q) = %v, want an error asking to quote !darwin", config, err)
+			}
+		}
+
+		// Those which parse are rejected when decoded too.
+		c := Condition{}
+		if err := yaml.Unmarshal([]byte(content), &c); err == nil {
+			t.Fatalf("expected Unmarshal(%q) to return an error", content)
+		}
+	}
+
+	for _, content := range []string{
+		"hooks:\n  pre_sync:\n    - !echo\n",
+		"when:\n  os: linux\nvariables:\n  greeting: !hello\n",
+	} {
+		err := CheckQuoting([]byte(content))
+		if err == nil || strings.Contains(err.Error(), "condition") || !strings.Contains(err.Error(), "values starting with ! must be quoted") {
+			t.Fatalf("CheckQuoting(%q) = %v, want an error which doesn't mention conditions", content, err)
+		}
+	}
+
+	for _, content := range []string{"when:\n  os: [linux, \"!darwin\"]\n", "when:\n  os: !!str linux\n", "when:\n  hostname: 'work!'\n"} {
+		if err := CheckQuoting([]byte(content)); err != nil {
+			t.Fatalf("CheckQuoting(%q) returned error: %v", content, err)
+		}
+	}
+}
+
+// indent prefixes each line of content with prefix.
+func indent(content, prefix string) string {
+	lines := strings.SplitAfter(content, "\n")
+	for idx, line := range lines {
+		if line != "" {
+			lines[idx] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+func TestReadDistro(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "os-release")
+	content := "NAME=\"Pop!_OS\"\nID=pop\nID_LIKE=\"ubuntu debian\"\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write os-release: %v", err)
+	}
+
+	if got, want := readDistro(file), []string{"pop", "ubuntu", "debian"}; !slices.Equal(got, want) {
+		t.Fatalf("readDistro = %q, want %q", got, want)
+	}
+
+	if got := readDistro(filepath.Join(t.TempDir(), "missing")); got != nil {
+		t.Fatalf("expected no distro without an os-release file, got %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := &Condition{
+		OS:       List{"Linux", "!darwin"},
+		Arch:     List{"arm64"},
+		Hostname: List{"work-*"},
+		Env:      List{"EDITOR=vim"},
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	invalid := []*Condition{
+		{OS: List{"macos"}},
+		{Arch: List{"x86_64"}},
+		{Hostname: List{"[work"}},
+		{Command: List{"!"}},
+	}
+
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected Validate(%+v) to return an error", c)
+		}
+	}
+}
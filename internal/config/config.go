@@ -2,45 +2,163 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/chasinglogic/dfm/internal/backup"
+	"github.com/chasinglogic/dfm/internal/condition"
 	"github.com/chasinglogic/dfm/internal/hooks"
+	"github.com/chasinglogic/dfm/internal/logger"
 	"github.com/chasinglogic/dfm/internal/mapping"
 	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/chasinglogic/dfm/internal/utils"
 	"github.com/goccy/go-yaml"
 )
 
 type LinkMode string
 
 type LLMConfig struct {
-	ModelProvider       string `yaml:"model_provider"`
-	Model               string `yaml:"model"`
-	CommitMessages      bool   `yaml:"commit_messages"`
-	CommitMessagePrompt string `yaml:"commit_message_prompt"`
+	ModelProvider       string `yaml:"model_provider,omitempty"`
+	Model               string `yaml:"model,omitempty"`
+	CommitMessages      bool   `yaml:"commit_messages,omitempty"`
+	CommitMessagePrompt string `yaml:"commit_message_prompt,omitempty"`
+}
+
+// BackupConfig is the retention policy for files dfm moved out of the way
+// when linking. Zero values mean no limit.
+type BackupConfig struct {
+	Keep       int `yaml:"keep,omitempty"`
+	MaxAgeDays int `yaml:"max_age_days,omitempty"`
+}
+
+func (bc BackupConfig) Retention() backup.Retention {
+	return backup.Retention{
+		Keep:   bc.Keep,
+		MaxAge: time.Duration(bc.MaxAgeDays) * 24 * time.Hour,
+	}
 }
 
 type Config struct {
 	Location string `yaml:"-"`
 
-	LinkMode               string             `yaml:"link_mode"`
-	Mappings               []*mapping.Mapping `yaml:"mappings"`
-	Modules                []Config           `yaml:"modules"`
-	PromptForCommitMessage bool               `yaml:"prompt_for_commit_message"`
-	PullOnly               bool               `yaml:"pull_only"`
-	Repo                   string             `yaml:"repository"`
-	RootDir                string             `yaml:"root_dir"`
-	Hooks                  hooks.Hooks        `yaml:"hooks"`
-	LLM                    LLMConfig          `yaml:"llm"`
+	// Version is the version of the config layout, see CurrentVersion. New
+	// config files are written with CurrentVersion.
+	Version                int                `yaml:"version,omitempty"`
+	LinkMode               string             `yaml:"link_mode,omitempty"`
+	LinkStrategy           string             `yaml:"link_strategy,omitempty"`
+	Mappings               []*mapping.Mapping `yaml:"mappings,omitempty"`
+	Modules                []Config           `yaml:"modules,omitempty"`
+	PromptForCommitMessage bool               `yaml:"prompt_for_commit_message,omitempty"`
+	PullOnly               bool               `yaml:"pull_only,omitempty"`
+	Repo                   string             `yaml:"repository,omitempty"`
+	RootDir                string             `yaml:"root_dir,omitempty"`
+	Targets                map[string]string  `yaml:"targets,omitempty"`
+	Hooks                  hooks.Hooks        `yaml:"hooks,omitempty"`
+	LLM                    LLMConfig          `yaml:"llm,omitempty"`
+	Backups                BackupConfig       `yaml:"backups,omitempty"`
+	Variables              map[string]any     `yaml:"variables,omitempty"`
+	DefaultMappings        *bool              `yaml:"default_mappings,omitempty"`
+	// Include lists files, relative to the config file, which are merged
+	// under it.
+	Include []string `yaml:"include,omitempty"`
+	// Extends names a profile or module whose mappings, hooks, variables and
+	// llm settings are merged under the config.
+	Extends string `yaml:"extends,omitempty"`
+	// When limits a module to machines matching the condition. It is only
+	// used for modules, Validate reports it at the top of a file.
+	When *condition.Condition `yaml:"when,omitempty"`
+
+	// origins maps the paths of values to the file they came from when the
+	// config was merged with files it includes, the profile it extends or the
+	// machine-local config. It is nil when nothing was merged. See Origin.
+	origins map[string]string
+
+	// unknownKeys are the keys in the config files which dfm doesn't know
+	// about, found when they were loaded.
+	unknownKeys []*UnknownKeyError
+
+	// outdated are the config files loaded which are older than
+	// CurrentVersion, they were migrated when they were loaded.
+	outdated []*Migration
+
+	// included are the files merged into the config through include, see
+	// IncludedFiles.
+	included []string
+}
+
+// IncludedFiles returns the paths of the files merged into the config through
+// include, including those included by included files. Like .dfm.yml they
+// are not linked.
+func (c *Config) IncludedFiles() []string {
+	return c.included
+}
+
+// mergedFiles returns the files other than .dfm.yml which values of the config
+// came from, sorted.
+func (c *Config) mergedFiles() []string {
+	configFile := filepath.Join(c.Location, ".dfm.yml")
+	files := []string{}
+	for _, file := range c.origins {
+		if file != configFile && !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+
+	slices.Sort(files)
+	return files
 }
 
+// UseDefaultMappings reports whether the built in mappings apply to the
+// profile, they do unless default_mappings is set to false.
+func (c *Config) UseDefaultMappings() bool {
+	return c.DefaultMappings == nil || *c.DefaultMappings
+}
+
+// Save writes the config to its .dfm.yml. An existing file is edited rather
+// than replaced so that only the parts of it which changed are rewritten,
+// keeping its comments and formatting. A config merged with other files
+// can't be saved since their values would be written to .dfm.yml, load it
+// with LoadCommitted instead.
 func (c *Config) Save() error {
+	if merged := c.mergedFiles(); len(merged) > 0 {
+		return fmt.Errorf("%s includes the values of %s, it can't be saved", c.Location, strings.Join(merged, ", "))
+	}
+
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(c.Location, ".dfm.yml"), data, 0644)
+
+	file := filepath.Join(c.Location, ".dfm.yml")
+	original, err := os.ReadFile(file)
+	if err == nil {
+		var migrated *Migration
+		// The config was loaded with any legacy keys renamed, those are
+		// named as they are in the file again so that only the changes
+		// made are saved. Renaming them is up to dfm config migrate.
+		if migrated, err = Migrate(file, original, false); err == nil {
+			data, err = undoRenames(data, migrated.renames)
+		}
+
+		if err == nil {
+			data, err = patchYAML(original, data, reflect.TypeOf(c))
+		}
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(file, data, 0644)
 }
 
 func (c *Config) String() string {
@@ -48,15 +166,44 @@ func (c *Config) String() string {
 	return string(data)
 }
 
+// Load loads configFile with the profile it extends and the files it
+// includes merged under it and the machine-local config next to it, if there
+// is one, merged over it.
 func Load(configFile string) (*Config, error) {
+	return load(configFile, true)
+}
+
+// LoadCommitted loads only configFile, without the profile it extends, the
+// files it includes or the machine-local config. This is the config to change
+// and Save.
+func LoadCommitted(configFile string) (*Config, error) {
+	return load(configFile, false)
+}
+
+func load(configFile string, resolve bool) (*Config, error) {
 	config := Config{
 		Location: filepath.Dir(configFile),
 	}
 
+	version := CurrentVersion
+	var outdated []*Migration
 	content, err := os.ReadFile(configFile)
-	if os.IsNotExist(err) {
-		return &config, nil
-	} else if err != nil {
+	if err == nil {
+		if err := condition.CheckQuoting(content); err != nil {
+			return &config, fmt.Errorf("%s: %w", configFile, err)
+		}
+
+		migrated, err := Migrate(configFile, content, false)
+		if err != nil {
+			return &config, err
+		}
+
+		if migrated.From < CurrentVersion {
+			outdated = append(outdated, migrated)
+		}
+
+		content = migrated.Content
+	} else if !os.IsNotExist(err) {
 		return &config, err
 	}
 
@@ -64,6 +211,55 @@ func Load(configFile string) (*Config, error) {
 		return &config, err
 	}
 
+	// The version stays unset in files written before there was one so
+	// saving them doesn't add it.
+	if config.Version != 0 || len(outdated) > 0 {
+		version = config.Version
+	}
+
+	unknown, err := findUnknownKeys(configFile, content, reflect.TypeOf(config))
+	if err != nil {
+		return &config, err
+	}
+
+	var origins map[string]string
+	var included []string
+	if resolve {
+		r := &resolver{}
+		resolved, merged, err := r.layer(configFile, content, filepath.Dir(configFile))
+		if err != nil {
+			return &config, err
+		}
+
+		local, hasLocal, err := r.local(configFile)
+		if err != nil {
+			return &config, err
+		}
+
+		if hasLocal {
+			resolved, merged = mergeLayers(resolved, local), true
+		}
+
+		unknown = append(unknown, r.unknown...)
+		outdated = append(outdated, r.outdated...)
+		included = r.included
+		if merged {
+			if err := config.decodeLayer(resolved); err != nil {
+				return &config, err
+			}
+
+			origins = resolved.origins
+		}
+	}
+
+	// Decoding an empty file resets config, including its location.
+	config.Location = filepath.Dir(configFile)
+	config.Version = version
+	config.unknownKeys = unknown
+	config.origins = origins
+	config.outdated = outdated
+	config.included = included
+
 	modulesDir, err := state.ModulesDir()
 	if err != nil {
 		return &config, err
@@ -80,13 +276,136 @@ func Load(configFile string) (*Config, error) {
 		)
 	}
 
-	return &config, nil
+	// Compiling every mapping up front means a typo is reported before
+	// anything is linked rather than part way through.
+	return &config, errors.Join(config.compileMappings(), config.unknownKeysError())
+}
+
+// decodeLayer replaces the config with the values of l.
+func (c *Config) decodeLayer(l layer) error {
+	content, err := yaml.Marshal(l.values)
+	if err != nil {
+		return err
+	}
+
+	*c = Config{}
+	return yaml.Unmarshal(content, c)
+}
+
+// unknownKeysError joins the unknown keys found loading the config, and its
+// machine-local config, unless Lenient is set.
+func (c *Config) unknownKeysError() error {
+	errs := make([]error, 0, len(c.unknownKeys))
+	for _, unknown := range c.unknownKeys {
+		if Lenient {
+			logger.Debug().Str("file", unknown.File).Msg(unknown.Error())
+			continue
+		}
+
+		errs = append(errs, unknown)
+	}
+
+	return errors.Join(errs...)
+}
+
+// MergeVariables returns the template variables in base with those in
+// override set over them. Nested maps are merged the same way, any other
+// value in override replaces the one in base.
+func MergeVariables(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]any)
+		overrideMap, overrideIsMap := value.(map[string]any)
+		if baseIsMap && overrideIsMap {
+			merged[key] = MergeVariables(baseMap, overrideMap)
+			continue
+		}
+
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// Module returns the config of the module called name, the name of its
+// repository or directory, searching the modules of modules too.
+func (c *Config) Module(name string) (*Config, error) {
+	var found *Config
+	c.walk("", func(cfg *Config, _ string) {
+		if found != nil || cfg == c {
+			return
+		}
+
+		if RepoToName(cfg.Repo) == name || filepath.Base(cfg.Location) == name {
+			found = cfg
+		}
+	})
+
+	if found == nil {
+		return nil, fmt.Errorf("no module named %s in %s", name, c.Location)
+	}
+
+	return found, nil
+}
+
+// FindMapping returns the index of the mapping selected by selector, which is
+// either an index or the match, glob or path of a single mapping.
+func (c *Config) FindMapping(selector string) (int, error) {
+	if idx, err := strconv.Atoi(selector); err == nil {
+		if idx < 0 || idx >= len(c.Mappings) {
+			return 0, fmt.Errorf("mapping %d does not exist, there are %d mappings", idx, len(c.Mappings))
+		}
+
+		return idx, nil
+	}
+
+	found := []int{}
+	for idx, m := range c.Mappings {
+		if m.Pattern() == selector {
+			found = append(found, idx)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("no mapping matches %s", selector)
+	case 1:
+		return found[0], nil
+	default:
+		return 0, fmt.Errorf("%d mappings match %s, select one by its index", len(found), selector)
+	}
 }
 
 func RepoToName(repo string) string {
 	return strings.ReplaceAll(filepath.Base(repo), ".git", "")
 }
 
+// Target is a directory in the profile whose contents are linked under Root,
+// which is a named target root or an absolute path.
+type Target struct {
+	Dir  string
+	Root string
+}
+
+// LinkTargets returns the profile's targets ordered by directory, or nil if
+// the whole dotfile directory is linked into the home directory.
+func (c *Config) LinkTargets() []Target {
+	targets := make([]Target, 0, len(c.Targets))
+	for dir, root := range c.Targets {
+		targets = append(targets, Target{Dir: dir, Root: root})
+	}
+
+	slices.SortFunc(targets, func(a, b Target) int {
+		return strings.Compare(a.Dir, b.Dir)
+	})
+
+	return targets
+}
+
 func (c *Config) GetDotfileDirectory() string {
 	// This works because if c.RootDir is "" then filepath.Join ignores it.
 	return filepath.Join(c.Location, c.RootDir)
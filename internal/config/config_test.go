@@ -3,8 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/chasinglogic/dfm/internal/mapping"
 	"github.com/chasinglogic/dfm/internal/state"
 )
 
@@ -122,3 +124,106 @@ func TestLoadParsesLLMConfig(t *testing.T) {
 		t.Fatalf("LLM.CommitMessagePrompt should not be empty")
 	}
 }
+
+func TestLoadMergesLocalVariables(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ".dfm.yml")
+
+	committed := "variables:\n  email: me@home.example\n  git:\n    signing: true\n    editor: vim\n"
+	if err := os.WriteFile(configFile, []byte(committed), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	local := "variables:\n  email: me@work.example\n  git:\n    editor: emacs\n"
+	if err := os.WriteFile(filepath.Join(dir, LocalConfigFile), []byte(local), 0644); err != nil {
+		t.Fatalf("failed to write local config: %v", err)
+	}
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	vars := cfg.Variables
+	if vars["email"] != "me@work.example" {
+		t.Fatalf("email = %v, want the local override", vars["email"])
+	}
+
+	git, ok := vars["git"].(map[string]any)
+	if !ok || git["editor"] != "emacs" || git["signing"] != true {
+		t.Fatalf("expected nested variables to be merged, got %v", vars["git"])
+	}
+
+	committedCfg, err := LoadCommitted(configFile)
+	if err != nil {
+		t.Fatalf("LoadCommitted returned error: %v", err)
+	}
+
+	if committedCfg.Variables["email"] != "me@home.example" {
+		t.Fatalf("local variables leaked into the committed config: %v", committedCfg.Variables)
+	}
+}
+
+func TestModuleFindsNestedModules(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Location: "/tmp/profile",
+		Modules: []Config{
+			{Repo: "https://github.com/me/work.git", Location: "/tmp/modules/work"},
+			{
+				Location: "/tmp/modules/outer",
+				Modules:  []Config{{Location: "/tmp/modules/inner"}},
+			},
+		},
+	}
+
+	for name, want := range map[string]string{"work": "/tmp/modules/work", "inner": "/tmp/modules/inner"} {
+		module, err := cfg.Module(name)
+		if err != nil {
+			t.Fatalf("Module(%q) returned error: %v", name, err)
+		}
+
+		if module.Location != want {
+			t.Fatalf("Module(%q) = %s, want %s", name, module.Location, want)
+		}
+	}
+
+	if _, err := cfg.Module("profile"); err == nil {
+		t.Fatal("expected the profile itself not to be found as a module")
+	}
+}
+
+func TestFindMapping(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		Mappings: []*mapping.Mapping{
+			{Glob: "**/*.md", Skip: true},
+			{Path: ".vim", LinkAsDir: true},
+			{Path: ".vim", TargetOS: "darwin", Skip: true},
+		},
+	}
+
+	cases := map[string]int{"1": 1, "**/*.md": 0}
+	for selector, want := range cases {
+		got, err := cfg.FindMapping(selector)
+		if err != nil || got != want {
+			t.Fatalf("FindMapping(%q) = %d, %v, want %d", selector, got, err, want)
+		}
+	}
+
+	failures := map[string]string{
+		"3":       "does not exist",
+		".bashrc": "no mapping matches",
+		".vim":    "2 mappings match",
+	}
+
+	for selector, want := range failures {
+		if _, err := cfg.FindMapping(selector); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("FindMapping(%q) error = %v, want it to contain %q", selector, err, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/backup"
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
+	"github.com/goccy/go-yaml"
+)
+
+// GlobalConfig holds the defaults for every profile, the config of a profile
+// takes precedence over them.
+type GlobalConfig struct {
+	// ProfilesDir is where profiles are kept instead of the profiles
+	// directory in the dfm cache directory.
+	ProfilesDir string `yaml:"profiles_dir,omitempty"`
+	// Overwrite makes link and clone --link replace conflicting files
+	// unless --overwrite=false is given.
+	Overwrite bool         `yaml:"overwrite,omitempty"`
+	LLM       LLMConfig    `yaml:"llm,omitempty"`
+	Backups   BackupConfig `yaml:"backups,omitempty"`
+}
+
+// Global is the global config, it is empty until LoadGlobal is called.
+var Global = &GlobalConfig{}
+
+// GlobalConfigFile returns the path of the global config, config.yml in the
+// dfm directory of $XDG_CONFIG_HOME.
+func GlobalConfigFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := mapping.ResolveRoot(mapping.RootXDGConfig, home)
+	return filepath.Join(dir, "dfm", "config.yml"), err
+}
+
+// LoadGlobal loads the global config into Global. It is empty if there is no
+// global config file.
+func LoadGlobal() error {
+	file, err := GlobalConfigFile()
+	if err != nil {
+		return err
+	}
+
+	global := &GlobalConfig{}
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		Global = global
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(content, global); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	unknown, err := findUnknownKeys(file, content, reflect.TypeOf(global))
+	if err != nil {
+		return err
+	}
+
+	Global = global
+	return (&Config{unknownKeys: unknown}).unknownKeysError()
+}
+
+// Save writes the global config to GlobalConfigFile, keeping the comments and
+// formatting of the parts of an existing file which didn't change.
+func (g *GlobalConfig) Save() error {
+	file, err := GlobalConfigFile()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	original, err := os.ReadFile(file)
+	if err == nil {
+		data, err = patchYAML(original, data, reflect.TypeOf(g))
+	} else if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(file, data, 0644)
+}
+
+// ProfilesPath returns the directory profiles_dir refers to, or "" if it
+// isn't set.
+func (g *GlobalConfig) ProfilesPath() (string, error) {
+	if g.ProfilesDir == "" {
+		return "", nil
+	}
+
+	if !filepath.IsAbs(g.ProfilesDir) && !strings.HasPrefix(g.ProfilesDir, "~/") {
+		return "", fmt.Errorf("profiles_dir must be an absolute path or start with ~/, got %q", g.ProfilesDir)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return mapping.ResolveRoot(g.ProfilesDir, home)
+}
+
+// GlobalKeys returns the keys of the global config in the form Get, Set and
+// Unset take them, such as llm.model.
+func GlobalKeys() []string {
+	return settingKeys(reflect.TypeOf(GlobalConfig{}), "")
+}
+
+func settingKeys(t reflect.Type, prefix string) []string {
+	keys := []string{}
+	for idx := range t.NumField() {
+		name, ok := yamlKey(t.Field(idx))
+		if !ok {
+			continue
+		}
+
+		if t.Field(idx).Type.Kind() == reflect.Struct {
+			keys = append(keys, settingKeys(t.Field(idx).Type, prefix+name+".")...)
+		} else {
+			keys = append(keys, prefix+name)
+		}
+	}
+
+	return keys
+}
+
+// setting returns the field of g which key, such as llm.model, refers to.
+func (g *GlobalConfig) setting(key string) (reflect.Value, error) {
+	if !slices.Contains(GlobalKeys(), key) {
+		message := fmt.Sprintf("unknown setting %q", key)
+		if suggestion := utils.Closest(key, GlobalKeys()); suggestion != "" {
+			message += fmt.Sprintf(", did you mean %q?", suggestion)
+		}
+
+		return reflect.Value{}, errors.New(message)
+	}
+
+	value := reflect.ValueOf(g).Elem()
+	for _, name := range strings.Split(key, ".") {
+		for idx := range value.NumField() {
+			if fieldName, ok := yamlKey(value.Type().Field(idx)); ok && fieldName == name {
+				value = value.Field(idx)
+				break
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// Get returns the value of key, such as llm.model.
+func (g *GlobalConfig) Get(key string) (string, error) {
+	value, err := g.setting(key)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(value.Interface()), nil
+}
+
+// Set sets key, such as llm.model, to value which is parsed according to the
+// type of the setting.
+func (g *GlobalConfig) Set(key, value string) error {
+	setting, err := g.setting(key)
+	if err != nil {
+		return err
+	}
+
+	switch setting.Kind() {
+	case reflect.String:
+		setting.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+
+		setting.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, got %q", key, value)
+		}
+
+		setting.SetInt(int64(parsed))
+	default:
+		return fmt.Errorf("%s can't be set from the command line", key)
+	}
+
+	if key == "profiles_dir" {
+		_, err = g.ProfilesPath()
+	}
+
+	return err
+}
+
+// Unset resets key, such as llm.model, to its default.
+func (g *GlobalConfig) Unset(key string) error {
+	setting, err := g.setting(key)
+	if err != nil {
+		return err
+	}
+
+	setting.SetZero()
+	return nil
+}
+
+// LLMSettings returns the LLM settings of the profile, those it doesn't set
+// come from the global config. The global model is only used with the global
+// provider since it is unlikely to exist for another.
+func (c *Config) LLMSettings() LLMConfig {
+	settings := c.LLM
+	if settings.ModelProvider == "" {
+		settings.ModelProvider = Global.LLM.ModelProvider
+	}
+
+	if settings.Model == "" && settings.ModelProvider == Global.LLM.ModelProvider {
+		settings.Model = Global.LLM.Model
+	}
+
+	if settings.CommitMessagePrompt == "" {
+		settings.CommitMessagePrompt = Global.LLM.CommitMessagePrompt
+	}
+
+	settings.CommitMessages = settings.CommitMessages || Global.LLM.CommitMessages
+	return settings
+}
+
+// BackupRetention returns the backup retention policy of the profile, limits
+// it doesn't set come from the global config.
+func (c *Config) BackupRetention() backup.Retention {
+	settings := c.Backups
+	if settings.Keep == 0 {
+		settings.Keep = Global.Backups.Keep
+	}
+
+	if settings.MaxAgeDays == 0 {
+		settings.MaxAgeDays = Global.Backups.MaxAgeDays
+	}
+
+	return settings.Retention()
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useGlobal points the global config at a new directory, writing content to
+// it unless it is empty, and restores Global when the test finishes.
+func useGlobal(t *testing.T, content string) string {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+
+	previous := Global
+	t.Cleanup(func() { Global = previous })
+
+	file := filepath.Join(home, "xdg", "dfm", "config.yml")
+	if content == "" {
+		return file
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("failed to create config directory: %v", err)
+	}
+
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write global config: %v", err)
+	}
+
+	return file
+}
+
+func TestLoadGlobal(t *testing.T) {
+	useGlobal(t, "overwrite: true\nprofiles_dir: ~/dotfiles\nllm:\n  model_provider: claude\nbackups:\n  keep: 3\n")
+
+	if err := LoadGlobal(); err != nil {
+		t.Fatalf("LoadGlobal returned error: %v", err)
+	}
+
+	if !Global.Overwrite || Global.LLM.ModelProvider != "claude" || Global.Backups.Keep != 3 {
+		t.Fatalf("unexpected global config: %+v", Global)
+	}
+
+	dir, err := Global.ProfilesPath()
+	if err != nil {
+		t.Fatalf("ProfilesPath returned error: %v", err)
+	}
+
+	if want := filepath.Join(os.Getenv("HOME"), "dotfiles"); dir != want {
+		t.Fatalf("ProfilesPath = %q, want %q", dir, want)
+	}
+}
+
+func TestLoadGlobalWithoutFile(t *testing.T) {
+	useGlobal(t, "")
+	Global = &GlobalConfig{Overwrite: true}
+
+	if err := LoadGlobal(); err != nil {
+		t.Fatalf("LoadGlobal returned error: %v", err)
+	}
+
+	if *Global != (GlobalConfig{}) {
+		t.Fatalf("expected an empty global config, got %+v", Global)
+	}
+}
+
+func TestLoadGlobalReportsUnknownKeys(t *testing.T) {
+	useGlobal(t, "overwrit: true\n")
+
+	err := LoadGlobal()
+	if err == nil || !strings.Contains(err.Error(), `did you mean "overwrite"?`) {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestGlobalSetGetUnset(t *testing.T) {
+	file := useGlobal(t, "# my defaults\nllm:\n  model_provider: claude # at work\n")
+	if err := LoadGlobal(); err != nil {
+		t.Fatalf("LoadGlobal returned error: %v", err)
+	}
+
+	settings := map[string]string{"llm.model": "sonnet", "backups.keep": "5", "overwrite": "true"}
+	for key, value := range settings {
+		if err := Global.Set(key, value); err != nil {
+			t.Fatalf("Set(%q) returned error: %v", key, err)
+		}
+
+		if got, err := Global.Get(key); err != nil || got != value {
+			t.Fatalf("Get(%q) = %q, %v, want %q", key, got, err, value)
+		}
+	}
+
+	if err := Global.Unset("overwrite"); err != nil {
+		t.Fatalf("Unset returned error: %v", err)
+	}
+
+	if err := Global.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read global config: %v", err)
+	}
+
+	want := "# my defaults\nllm:\n  model_provider: claude # at work\n  model: sonnet\nbackups:\n  keep: 5\n"
+	if string(content) != want {
+		t.Fatalf("saved global config:\n%s\nwant:\n%s", content, want)
+	}
+
+	if err := Global.Set("backups.keep", "many"); err == nil {
+		t.Fatalf("expected setting an int to a word to fail")
+	}
+
+	if err := Global.Set("llm.modle", "x"); err == nil || !strings.Contains(err.Error(), `"llm.model"`) {
+		t.Fatalf("expected an unknown setting error suggesting llm.model, got %v", err)
+	}
+}
+
+func TestProfileSettingsTakePrecedence(t *testing.T) {
+	useGlobal(t, "")
+	Global = &GlobalConfig{
+		LLM:     LLMConfig{ModelProvider: "claude", Model: "sonnet", CommitMessages: true},
+		Backups: BackupConfig{Keep: 3, MaxAgeDays: 30},
+	}
+
+	inherited := (&Config{}).LLMSettings()
+	if inherited != Global.LLM {
+		t.Fatalf("expected the global LLM settings, got %+v", inherited)
+	}
+
+	own := (&Config{LLM: LLMConfig{ModelProvider: "gemini"}}).LLMSettings()
+	if own.ModelProvider != "gemini" || own.Model != "" || !own.CommitMessages {
+		t.Fatalf("expected the profile's provider without the global model, got %+v", own)
+	}
+
+	retention := (&Config{Backups: BackupConfig{Keep: 10}}).BackupRetention()
+	if retention.Keep != 10 || retention.MaxAge != 30*24*time.Hour {
+		t.Fatalf("unexpected retention: %+v", retention)
+	}
+}
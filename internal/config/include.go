@@ -0,0 +1,212 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/condition"
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/goccy/go-yaml"
+)
+
+// inheritedKeys are the keys a config takes from the profile it extends.
+var inheritedKeys = []string{"mappings", "hooks", "variables", "llm"}
+
+// resolver reads config files along with the files they include and the
+// profiles they extend.
+type resolver struct {
+	// stack holds the files being resolved to detect cycles.
+	stack []string
+	// unknown are the unknown keys found in the files read.
+	unknown []*UnknownKeyError
+	// outdated are the files read which are older than CurrentVersion.
+	outdated []*Migration
+	// included are the files read through include.
+	included []string
+}
+
+// layer returns the layer of file, whose content is given, with the profile it
+// extends and the files it includes merged under it in that order. Files it
+// includes must be in root. merged reports whether any were merged.
+func (r *resolver) layer(file string, content []byte, root string) (l layer, merged bool, err error) {
+	if slices.Contains(r.stack, file) {
+		return layer{}, false, fmt.Errorf("include or extends cycle: %s", strings.Join(append(r.stack, file), " -> "))
+	}
+
+	r.stack = append(r.stack, file)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return layer{}, false, err
+	}
+
+	layers := []layer{}
+	if extends, ok := values["extends"].(string); ok && extends != "" {
+		parentFile, err := extendsFile(file, extends)
+		if err != nil {
+			return layer{}, false, err
+		}
+
+		parent, err := r.read(parentFile, filepath.Dir(parentFile))
+		if err != nil {
+			return layer{}, false, err
+		}
+
+		for key := range parent.values {
+			if !slices.Contains(inheritedKeys, key) {
+				delete(parent.values, key)
+			}
+		}
+
+		layers = append(layers, parent)
+	}
+
+	includes, _ := values["include"].([]any)
+	for _, include := range includes {
+		includeFile, err := includePath(file, include, root)
+		if err != nil {
+			return layer{}, false, err
+		}
+
+		included, err := r.read(includeFile, root)
+		if err != nil {
+			return layer{}, false, err
+		}
+
+		r.included = append(r.included, includeFile)
+		layers = append(layers, included)
+	}
+
+	l = fileLayer(values, file)
+	if len(layers) == 0 {
+		return l, false, nil
+	}
+
+	for idx := len(layers) - 1; idx >= 0; idx-- {
+		l = mergeLayers(layers[idx], l)
+	}
+
+	return l, true, nil
+}
+
+// read returns the layer of the config file at file, see layer.
+func (r *resolver) read(file string, root string) (layer, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return layer{}, err
+	}
+
+	if err := condition.CheckQuoting(content); err != nil {
+		return layer{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	migrated, err := Migrate(file, content, false)
+	if err != nil {
+		return layer{}, err
+	}
+
+	if migrated.From < CurrentVersion {
+		r.outdated = append(r.outdated, migrated)
+	}
+
+	content = migrated.Content
+
+	// Decoding into a config first reports mistakes with the line they are
+	// on in file rather than in the merged content.
+	if err := yaml.Unmarshal(content, &Config{}); err != nil {
+		return layer{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	unknown, err := findUnknownKeys(file, content, reflect.TypeOf(Config{}))
+	if err != nil {
+		return layer{}, err
+	}
+
+	r.unknown = append(r.unknown, unknown...)
+
+	l, _, err := r.layer(file, content, root)
+	return l, err
+}
+
+// includePath returns the path of the file include, an entry of the include
+// key of file, refers to. It must be in root.
+func includePath(file string, include any, root string) (string, error) {
+	name, ok := include.(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("%s: include entries must be paths, got %v", file, include)
+	}
+
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("%s: include %q must be relative to the file including it", file, name)
+	}
+
+	path := filepath.Join(filepath.Dir(file), name)
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%s: include %q is not in %s", file, name, root)
+	}
+
+	return path, nil
+}
+
+// extendsFile returns the .dfm.yml of the profile or module extends, the
+// extends key of file, refers to. It is a path, relative paths starting with
+// ./ or ../ are relative to file, or the name of a profile or the name or
+// repository of a module.
+func extendsFile(file, extends string) (string, error) {
+	var dirs []string
+	switch {
+	case strings.HasPrefix(extends, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		dirs = []string{filepath.Join(home, extends[2:])}
+	case filepath.IsAbs(extends):
+		dirs = []string{extends}
+	case strings.HasPrefix(extends, "./") || strings.HasPrefix(extends, "../"):
+		dirs = []string{filepath.Join(filepath.Dir(file), extends)}
+	default:
+		profilesDir, err := state.ProfilesDir()
+		if err != nil {
+			return "", err
+		}
+
+		modulesDir, err := state.ModulesDir()
+		if err != nil {
+			return "", err
+		}
+
+		dirs = []string{filepath.Join(profilesDir, extends), filepath.Join(modulesDir, RepoToName(extends))}
+	}
+
+	for _, dir := range dirs {
+		parent := filepath.Join(dir, ".dfm.yml")
+		if _, err := os.Stat(parent); err == nil {
+			return parent, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("%s: extends %q: no profile or module with a .dfm.yml, looked in %s",
+		file, extends, strings.Join(dirs, ", "))
+}
+
+// local returns the layer of the machine-local config next to configFile,
+// false if there isn't one.
+func (r *resolver) local(configFile string) (layer, bool, error) {
+	localFile := filepath.Join(filepath.Dir(configFile), LocalConfigFile)
+	if _, err := os.Stat(localFile); os.IsNotExist(err) {
+		return layer{}, false, nil
+	}
+
+	l, err := r.read(localFile, filepath.Dir(configFile))
+	return l, err == nil, err
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes each file, relative to dir, with its content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func mappingPatterns(cfg *Config) []string {
+	patterns := []string{}
+	for _, m := range cfg.Mappings {
+		patterns = append(patterns, m.Pattern())
+	}
+
+	return patterns
+}
+
+func TestLoadMergesIncludes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".dfm.yml": "include:\n  - dfm/base.yml\n  - dfm/work.yml\nlink_strategy: copy\nmappings:\n  - match: own\n    skip: true\n",
+		"dfm/base.yml": "link_strategy: softlink\npull_only: true\nmappings:\n  - match: base\n    skip: true\n" +
+			"hooks:\n  post_link:\n    - echo base\n",
+		"dfm/work.yml":   "include:\n  - shared.yml\nmappings:\n  - match: work\n    skip: true\nhooks:\n  post_link:\n    - echo work\n",
+		"dfm/shared.yml": "variables:\n  editor: vim\n",
+	})
+
+	configFile := filepath.Join(dir, ".dfm.yml")
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.LinkStrategy != "copy" || !cfg.PullOnly || cfg.Variables["editor"] != "vim" {
+		t.Fatalf("expected the included values under the file's own, got %+v", cfg)
+	}
+
+	if patterns := mappingPatterns(cfg); !slices.Equal(patterns, []string{"own", "work", "base"}) {
+		t.Fatalf("expected the file's mappings first and later includes before earlier ones, got %v", patterns)
+	}
+
+	if commands := cfg.Hooks["post_link"]; len(commands) != 2 || commands[0] != "echo base" || commands[1] != "echo work" {
+		t.Fatalf("expected the hook commands in include order, got %v", commands)
+	}
+
+	origins := map[string]string{
+		"mappings[0]": configFile,
+		"mappings[1]": filepath.Join(dir, "dfm", "work.yml"),
+		"pull_only":   filepath.Join(dir, "dfm", "base.yml"),
+		"variables":   filepath.Join(dir, "dfm", "shared.yml"),
+	}
+
+	for path, file := range origins {
+		if got := cfg.Origin(path); got != file {
+			t.Fatalf("Origin(%q) = %s, want %s", path, got, file)
+		}
+	}
+
+	committed, err := LoadCommitted(configFile)
+	if err != nil {
+		t.Fatalf("LoadCommitted returned error: %v", err)
+	}
+
+	if patterns := mappingPatterns(committed); !slices.Equal(patterns, []string{"own"}) || committed.PullOnly {
+		t.Fatalf("expected LoadCommitted to leave out included files, got %+v", committed)
+	}
+}
+
+func TestLoadRejectsBadIncludes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	cases := map[string]map[string]string{
+		"is not in": {
+			".dfm.yml": "include:\n  - ../outside.yml\n",
+		},
+		"must be relative": {
+			".dfm.yml": "include:\n  - /etc/dfm.yml\n",
+		},
+		"cycle": {
+			".dfm.yml": "include:\n  - a.yml\n",
+			"a.yml":    "include:\n  - b.yml\n",
+			"b.yml":    "include:\n  - a.yml\n",
+		},
+		"no such file": {
+			".dfm.yml": "include:\n  - missing.yml\n",
+		},
+	}
+
+	for want, files := range cases {
+		dir := t.TempDir()
+		writeFiles(t, dir, files)
+
+		_, err := Load(filepath.Join(dir, ".dfm.yml"))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected an error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadMergesExtendedProfile(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+
+	base := filepath.Join(cache, "dfm", "profiles", "base")
+	writeFiles(t, base, map[string]string{
+		".dfm.yml": "include:\n  - hooks.yml\npull_only: true\nmappings:\n  - match: base\n    skip: true\n" +
+			"variables:\n  git:\n    editor: vim\n    signing: true\nllm:\n  model_provider: claude\n",
+		"hooks.yml": "hooks:\n  post_link:\n    - echo base\n",
+	})
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".dfm.yml": "extends: base\nmappings:\n  - match: own\n    skip: true\nvariables:\n  git:\n    editor: emacs\n" +
+			"hooks:\n  post_link:\n    - echo own\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, ".dfm.yml"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if patterns := mappingPatterns(cfg); !slices.Equal(patterns, []string{"own", "base"}) {
+		t.Fatalf("expected the extended mappings after the profile's own, got %v", patterns)
+	}
+
+	if commands := cfg.Hooks["post_link"]; len(commands) != 2 || commands[0] != "echo base" {
+		t.Fatalf("expected the extended hook commands to run first, got %v", commands)
+	}
+
+	git, _ := cfg.Variables["git"].(map[string]any)
+	if git["editor"] != "emacs" || git["signing"] != true || cfg.LLM.ModelProvider != "claude" {
+		t.Fatalf("expected variables and llm to be inherited, got %v %+v", cfg.Variables, cfg.LLM)
+	}
+
+	if cfg.PullOnly {
+		t.Fatalf("expected pull_only not to be inherited")
+	}
+
+	if got, want := cfg.Origin("hooks.post_link[0]"), filepath.Join(base, "hooks.yml"); got != want {
+		t.Fatalf("Origin of the extended hook = %s, want %s", got, want)
+	}
+}
+
+func TestLoadRejectsBadExtends(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a/.dfm.yml": "extends: ../b\n",
+		"b/.dfm.yml": "extends: ../a\n",
+		"c/.dfm.yml": "extends: missing\n",
+	})
+
+	if _, err := Load(filepath.Join(dir, "a", ".dfm.yml")); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected an extends cycle error, got %v", err)
+	}
+
+	if _, err := Load(filepath.Join(dir, "c", ".dfm.yml")); err == nil || !strings.Contains(err.Error(), `extends "missing"`) {
+		t.Fatalf("expected a missing profile error, got %v", err)
+	}
+}
+
+func TestValidateReportsModuleIncludes(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{Modules: []Config{{Repo: "https://example.com/work.git", Include: []string{"a.yml"}, Extends: "base"}}}
+
+	paths := []string{}
+	for _, problem := range cfg.Validate() {
+		paths = append(paths, problem.Path)
+	}
+
+	if !slices.Equal(paths, []string{"modules[0].include", "modules[0].extends"}) {
+		t.Fatalf("expected problems with the module's include and extends, got %v", paths)
+	}
+}
+
+func TestSaveNamesIncludedFiles(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".dfm.yml":  "include:\n  - hooks.yml\n",
+		"hooks.yml": "hooks:\n  pre_link:\n    - echo included\n",
+	})
+
+	cfg, err := Load(filepath.Join(dir, ".dfm.yml"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	err = cfg.Save()
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "hooks.yml")) || strings.Contains(err.Error(), LocalConfigFile) {
+		t.Fatalf("expected Save to refuse naming the included file, got %v", err)
+	}
+}
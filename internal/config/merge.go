@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// LocalConfigFile is the name of the uncommitted, machine-local config file
+// which is read from the same directory as .dfm.yml and merged over it.
+const LocalConfigFile = ".dfm.local.yml"
+
+// layer is a config decoded into a map along with the file each of its values
+// came from, keyed by their path such as modules[0].mappings[1].skip.
+type layer struct {
+	values  map[string]any
+	origins map[string]string
+}
+
+// fileLayer returns values, which were read from file, as a layer.
+func fileLayer(values map[string]any, file string) layer {
+	origins := map[string]string{}
+	record(origins, "", values, file)
+	return layer{values: values, origins: origins}
+}
+
+// record notes that value, at path, and everything inside it came from file.
+func record(origins map[string]string, path string, value any, file string) {
+	origins[path] = file
+	switch v := value.(type) {
+	case map[string]any:
+		for key, entry := range v {
+			record(origins, joinKey(path, key), entry, file)
+		}
+	case []any:
+		for idx, entry := range v {
+			record(origins, index(path, idx), entry, file)
+		}
+	}
+}
+
+// mergeLayers merges override over base. Mappings from override come first so
+// that they take precedence, modules with the same repository are merged,
+// hook commands run after those in base and when conditions are replaced.
+// Maps are merged key by key, any other value in override replaces the one in
+// base and a key set to null is unset.
+func mergeLayers(base, override layer) layer {
+	m := &merger{base: base.origins, override: override.origins, origins: map[string]string{}}
+	return layer{values: m.config("", "", "", base.values, override.values), origins: m.origins}
+}
+
+// merger merges two layers, the methods take the path of the value in the
+// result followed by its paths in the base and override layers.
+type merger struct {
+	base     map[string]string
+	override map[string]string
+	origins  map[string]string
+}
+
+// take copies the origins of the value at src in from, and everything inside
+// it, to dst in the result.
+func (m *merger) take(from map[string]string, src, dst string) {
+	for path, file := range from {
+		if path == src {
+			m.origins[dst] = file
+		} else if rest, ok := strings.CutPrefix(path, src); ok && (rest[0] == '.' || rest[0] == '[') {
+			m.origins[dst+rest] = file
+		}
+	}
+}
+
+func (m *merger) config(out, basePath, overridePath string, base, override map[string]any) map[string]any {
+	merged := map[string]any{}
+	for key, value := range base {
+		if _, overridden := override[key]; !overridden {
+			merged[key] = value
+			m.take(m.base, joinKey(basePath, key), joinKey(out, key))
+		}
+	}
+
+	for key, value := range override {
+		outKey, baseKey, overrideKey := joinKey(out, key), joinKey(basePath, key), joinKey(overridePath, key)
+		baseValue, inBase := base[key]
+		baseList, baseIsList := baseValue.([]any)
+		list, isList := value.([]any)
+
+		switch {
+		case value == nil:
+			// A key set to null is unset.
+		case !inBase:
+			merged[key] = value
+			m.take(m.override, overrideKey, outKey)
+		case key == "mappings" && baseIsList && isList:
+			merged[key] = m.concat(outKey, m.override, overrideKey, list, m.base, baseKey, baseList)
+		case key == "modules" && baseIsList && isList:
+			merged[key] = m.modules(outKey, baseKey, overrideKey, baseList, list)
+		case key == "hooks":
+			merged[key] = m.hooks(outKey, baseKey, overrideKey, baseValue, value)
+		case key == "when":
+			merged[key] = value
+			m.take(m.override, overrideKey, outKey)
+		default:
+			merged[key] = m.value(outKey, baseKey, overrideKey, baseValue, value)
+		}
+	}
+
+	return merged
+}
+
+// value merges override over base. Maps are merged key by key, any other
+// value in override replaces the one in base.
+func (m *merger) value(out, basePath, overridePath string, base, override any) any {
+	// Values repeated in override, such as the repository of a module,
+	// still come from base.
+	if reflect.DeepEqual(base, override) {
+		m.take(m.base, basePath, out)
+		return base
+	}
+
+	baseMap, baseIsMap := base.(map[string]any)
+	overrideMap, overrideIsMap := override.(map[string]any)
+	if !baseIsMap || !overrideIsMap {
+		m.take(m.override, overridePath, out)
+		return override
+	}
+
+	merged := map[string]any{}
+	m.origins[out] = m.override[overridePath]
+	for key, value := range baseMap {
+		if _, overridden := overrideMap[key]; !overridden {
+			merged[key] = value
+			m.take(m.base, joinKey(basePath, key), joinKey(out, key))
+		}
+	}
+
+	for key, value := range overrideMap {
+		if value == nil {
+			continue
+		}
+
+		outKey, overrideKey := joinKey(out, key), joinKey(overridePath, key)
+		if baseValue, ok := baseMap[key]; ok {
+			merged[key] = m.value(outKey, joinKey(basePath, key), overrideKey, baseValue, value)
+		} else {
+			merged[key] = value
+			m.take(m.override, overrideKey, outKey)
+		}
+	}
+
+	return merged
+}
+
+// hooks appends the commands of each hook in override to those in base.
+func (m *merger) hooks(out, basePath, overridePath string, base, override any) any {
+	baseHooks, baseIsMap := base.(map[string]any)
+	overrideHooks, overrideIsMap := override.(map[string]any)
+	if !baseIsMap || !overrideIsMap {
+		return m.value(out, basePath, overridePath, base, override)
+	}
+
+	merged := map[string]any{}
+	m.origins[out] = m.override[overridePath]
+	for name, commands := range baseHooks {
+		if _, overridden := overrideHooks[name]; !overridden {
+			merged[name] = commands
+			m.take(m.base, joinKey(basePath, name), joinKey(out, name))
+		}
+	}
+
+	for name, commands := range overrideHooks {
+		outName, baseName, overrideName := joinKey(out, name), joinKey(basePath, name), joinKey(overridePath, name)
+		baseCommands, baseIsList := baseHooks[name].([]any)
+		overrideCommands, overrideIsList := commands.([]any)
+		if baseIsList && overrideIsList {
+			merged[name] = m.concat(outName, m.base, baseName, baseCommands, m.override, overrideName, overrideCommands)
+			continue
+		}
+
+		if commands != nil {
+			merged[name] = commands
+			m.take(m.override, overrideName, outName)
+		}
+	}
+
+	return merged
+}
+
+// modules merges each module in override over the module in base with the
+// same repository, modules without one in base are added after them.
+func (m *merger) modules(out, basePath, overridePath string, base, override []any) []any {
+	merged := make([]any, len(base), len(base)+len(override))
+	copy(merged, base)
+	// overrides holds the index in override of the module merged over each
+	// module in base, or -1.
+	overrides := make([]int, len(base))
+	for idx := range overrides {
+		overrides[idx] = -1
+	}
+
+	m.origins[out] = m.override[overridePath]
+	for overrideIdx, value := range override {
+		module, _ := value.(map[string]any)
+		idx := -1
+		for baseIdx, baseValue := range base {
+			baseModule, _ := baseValue.(map[string]any)
+			if module["repository"] != nil && baseModule["repository"] == module["repository"] {
+				idx = baseIdx
+				break
+			}
+		}
+
+		if idx == -1 {
+			m.take(m.override, index(overridePath, overrideIdx), index(out, len(merged)))
+			merged = append(merged, value)
+			continue
+		}
+
+		overrides[idx] = overrideIdx
+	}
+
+	for idx, value := range base {
+		baseModule, ok := value.(map[string]any)
+		if overrides[idx] == -1 || !ok {
+			m.take(m.base, index(basePath, idx), index(out, idx))
+			continue
+		}
+
+		overrideModule := index(overridePath, overrides[idx])
+		m.origins[index(out, idx)] = m.override[overrideModule]
+		merged[idx] = m.config(index(out, idx), index(basePath, idx), overrideModule,
+			baseModule, override[overrides[idx]].(map[string]any))
+	}
+
+	return merged
+}
+
+// concat returns the entries of first followed by those of second, which are
+// at firstPath in the layer with firstOrigins and secondPath in the layer with
+// secondOrigins.
+func (m *merger) concat(
+	out string,
+	firstOrigins map[string]string, firstPath string, first []any,
+	secondOrigins map[string]string, secondPath string, second []any,
+) []any {
+	merged := make([]any, 0, len(first)+len(second))
+	for idx, value := range first {
+		m.take(firstOrigins, index(firstPath, idx), index(out, len(merged)))
+		merged = append(merged, value)
+	}
+
+	for idx, value := range second {
+		m.take(secondOrigins, index(secondPath, idx), index(out, len(merged)))
+		merged = append(merged, value)
+	}
+
+	return merged
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func index(path string, idx int) string {
+	return fmt.Sprintf("%s[%d]", path, idx)
+}
+
+// Origin returns the config file the value at path, such as
+// modules[0].mappings[1], came from. That is .dfm.yml unless the value was
+// merged from a file it includes, the profile it extends or the machine-local
+// config.
+func (c *Config) Origin(path string) string {
+	for path != "" {
+		if file, ok := c.origins[path]; ok {
+			return file
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut == -1 {
+			break
+		}
+
+		path = path[:cut]
+	}
+
+	return filepath.Join(c.Location, ".dfm.yml")
+}
+
+// Annotated returns the config as YAML with a comment naming the file each
+// value came from.
+func (c *Config) Annotated() ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	annotate := func(node ast.Node, path string) {
+		origin := " " + filepath.Base(c.Origin(path))
+		_ = node.SetComment(ast.CommentGroup([]*token.Token{token.Comment(origin, origin, &token.Position{})}))
+	}
+
+	var walk func(node ast.Node, path string)
+	walk = func(node ast.Node, path string) {
+		switch n := node.(type) {
+		case *ast.MappingNode:
+			for _, value := range n.Values {
+				walk(value, joinKey(path, value.Key.GetToken().Value))
+			}
+		case *ast.MappingValueNode:
+			if _, ok := n.Value.(ast.ScalarNode); ok {
+				annotate(n.Value, path)
+			} else {
+				walk(n.Value, path)
+			}
+		case *ast.SequenceNode:
+			for idx, value := range n.Values {
+				entryPath := index(path, idx)
+				if _, ok := value.(ast.ScalarNode); ok {
+					annotate(value, entryPath)
+				} else {
+					walk(value, entryPath)
+				}
+			}
+		}
+	}
+
+	for _, doc := range file.Docs {
+		walk(doc.Body, "")
+	}
+
+	return []byte(file.String()), nil
+}
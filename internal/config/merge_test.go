@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const committedConfig = `pull_only: true
+link_strategy: softlink
+mappings:
+  - match: foo
+    skip: true
+modules:
+  - repository: https://example.com/work.git
+    pull_only: true
+    when:
+      os: linux
+hooks:
+  post_link:
+    - echo linked
+  pre_sync:
+    - echo syncing
+llm:
+  model_provider: openai
+  model: gpt
+variables:
+  git:
+    editor: vim
+    signing: true
+`
+
+const localOverride = `link_strategy: copy
+link_mode: null
+pull_only: null
+mappings:
+  - glob: "*.md"
+    skip: true
+modules:
+  - repository: https://example.com/work.git
+    pull_only: false
+    when:
+      hostname: work-laptop
+  - repository: https://example.com/extra.git
+hooks:
+  post_link:
+    - echo local
+llm:
+  model: gpt-5
+variables:
+  git:
+    editor: emacs
+`
+
+// writeMergeProfile writes the given .dfm.yml and .dfm.local.yml to a new
+// directory and returns the path of the .dfm.yml.
+func writeMergeProfile(t *testing.T, committed, local string) string {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ".dfm.yml")
+	if err := os.WriteFile(configFile, []byte(committed), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, LocalConfigFile), []byte(local), 0644); err != nil {
+		t.Fatalf("failed to write local config: %v", err)
+	}
+
+	return configFile
+}
+
+func TestLoadMergesLocalConfig(t *testing.T) {
+	configFile := writeMergeProfile(t, committedConfig, localOverride)
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.PullOnly || cfg.LinkStrategy != "copy" {
+		t.Fatalf("expected scalars to be replaced or unset, got pull_only=%v link_strategy=%q", cfg.PullOnly, cfg.LinkStrategy)
+	}
+
+	patterns := []string{}
+	for _, m := range cfg.Mappings {
+		patterns = append(patterns, m.Pattern())
+	}
+
+	if !slices.Equal(patterns, []string{"*.md", "foo"}) {
+		t.Fatalf("expected the local mappings to come first, got %v", patterns)
+	}
+
+	if len(cfg.Modules) != 2 {
+		t.Fatalf("expected the work module to be merged and the extra one added, got %d modules", len(cfg.Modules))
+	}
+
+	work := cfg.Modules[0]
+	if work.PullOnly || work.When == nil || len(work.When.Hostname) != 1 || work.When.Hostname[0] != "work-laptop" || len(work.When.OS) != 0 {
+		t.Fatalf("expected the work module to be merged with its when replaced, got %+v", work)
+	}
+
+	if cfg.Modules[1].Repo != "https://example.com/extra.git" || cfg.Modules[1].Location == "" {
+		t.Fatalf("unexpected extra module: %+v", cfg.Modules[1])
+	}
+
+	if len(cfg.Hooks["post_link"]) != 2 || cfg.Hooks["post_link"][1] != "echo local" || len(cfg.Hooks["pre_sync"]) != 1 {
+		t.Fatalf("expected the local hook commands to run after the committed ones, got %v", cfg.Hooks)
+	}
+
+	if cfg.LLM.ModelProvider != "openai" || cfg.LLM.Model != "gpt-5" {
+		t.Fatalf("expected llm to be merged key by key, got %+v", cfg.LLM)
+	}
+
+	git, ok := cfg.Variables["git"].(map[string]any)
+	if !ok || git["editor"] != "emacs" || git["signing"] != true {
+		t.Fatalf("expected variables to be merged key by key, got %v", cfg.Variables)
+	}
+}
+
+func TestLoadRecordsOrigins(t *testing.T) {
+	configFile := writeMergeProfile(t, committedConfig, localOverride)
+	localFile := filepath.Join(filepath.Dir(configFile), LocalConfigFile)
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	want := map[string]string{
+		"mappings[0]":            localFile,
+		"mappings[1].match":      configFile,
+		"modules[0].repository":  configFile,
+		"modules[0].when":        localFile,
+		"modules[1]":             localFile,
+		"hooks.post_link[0]":     configFile,
+		"hooks.post_link[1]":     localFile,
+		"llm.model_provider":     configFile,
+		"llm.model":              localFile,
+		"variables.git.signing":  configFile,
+		"variables.git.editor":   localFile,
+		"default_mappings":       configFile,
+		"modules[1].mappings[0]": localFile,
+	}
+
+	for path, file := range want {
+		if got := cfg.Origin(path); got != file {
+			t.Fatalf("Origin(%q) = %s, want %s", path, got, file)
+		}
+	}
+}
+
+func TestAnnotatedNamesOrigins(t *testing.T) {
+	configFile := writeMergeProfile(t, "llm:\n  model_provider: openai\n  model: gpt\n", "llm:\n  model: gpt-5\n")
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	data, err := cfg.Annotated()
+	if err != nil {
+		t.Fatalf("Annotated returned error: %v", err)
+	}
+
+	for _, line := range []string{"model_provider: openai # .dfm.yml", "model: gpt-5 # .dfm.local.yml"} {
+		if !strings.Contains(string(data), line) {
+			t.Fatalf("expected %q in the annotated config, got:\n%s", line, data)
+		}
+	}
+}
+
+func TestSaveRefusesMergedConfig(t *testing.T) {
+	configFile := writeMergeProfile(t, "pull_only: true\n", "link_strategy: copy\n")
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if err := cfg.Save(); err == nil {
+		t.Fatalf("expected saving a merged config to fail")
+	}
+
+	committed, err := LoadCommitted(configFile)
+	if err != nil {
+		t.Fatalf("LoadCommitted returned error: %v", err)
+	}
+
+	if committed.LinkStrategy != "" || !committed.PullOnly {
+		t.Fatalf("expected only the committed config, got %+v", committed)
+	}
+
+	if err := committed.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+}
+
+func TestValidateReportsLocalFile(t *testing.T) {
+	configFile := writeMergeProfile(t, "mappings:\n  - match: foo\n", "mappings:\n  - match: bar\n    target_os: beos\n")
+	localFile := filepath.Join(filepath.Dir(configFile), LocalConfigFile)
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	problems := cfg.Validate()
+	if len(problems) != 1 || problems[0].Path != "mappings[0]" || problems[0].File != localFile {
+		t.Fatalf("expected a problem with mappings[0] in %s, got %+v", localFile, problems)
+	}
+}
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/hooks"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// CurrentVersion is the version of the config layout this dfm reads. Configs
+// without a version key are version 1.
+const CurrentVersion = 2
+
+// migration upgrades a config, or a module in it, from the version before the
+// one it is registered for. It returns the keys it renamed.
+type migration func(config *ast.MappingNode, path string) []rename
+
+// rename is a key renamed by a migration. path is the prefix locating the
+// mapping the key is in, such as modules[0].hooks., and conflict is set when
+// the key couldn't be renamed since the new key already existed.
+type rename struct {
+	path     string
+	from     string
+	to       string
+	conflict bool
+}
+
+func (r rename) String() string {
+	if r.conflict {
+		return fmt.Sprintf("%s%s can't be renamed to %s since it already exists, merge them by hand", r.path, r.from, r.to)
+	}
+
+	return fmt.Sprintf("%s%s renamed to %s", r.path, r.from, r.to)
+}
+
+// migrations holds the migration to each version, migrations[2] upgrades a
+// version 1 config to version 2.
+var migrations = map[int]migration{
+	2: migrateLegacyNames,
+}
+
+// Migration is the result of upgrading a config file to CurrentVersion.
+type Migration struct {
+	File string
+	From int
+	To   int
+	// Changes describes each change made to the file, it is empty when only
+	// the version needed changing.
+	Changes []string
+	// Content is the upgraded file.
+	Content []byte
+
+	renames []rename
+}
+
+// Migrate upgrades content, the config file at file, to CurrentVersion
+// keeping its comments and formatting. With stamp the version key is set to
+// CurrentVersion, otherwise it is left as it was. Configs newer than
+// CurrentVersion are an error.
+func Migrate(file string, content []byte, stamp bool) (*Migration, error) {
+	result := &Migration{File: file, From: CurrentVersion, To: CurrentVersion, Content: content}
+
+	parsed, err := parser.ParseBytes(content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// A file without any keys has nothing to migrate, it is as good as a new
+	// one.
+	if len(parsed.Docs) != 1 {
+		return result, nil
+	}
+
+	config, ok := parsed.Docs[0].Body.(*ast.MappingNode)
+	if !ok || config.IsFlowStyle || len(config.Values) == 0 {
+		return result, nil
+	}
+
+	version, err := configVersion(file, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result.From = version
+	if version == CurrentVersion {
+		return result, nil
+	}
+
+	for to := version + 1; to <= CurrentVersion; to++ {
+		result.renames = append(result.renames, migrateConfig(migrations[to], config, "")...)
+	}
+
+	for _, r := range result.renames {
+		result.Changes = append(result.Changes, r.String())
+	}
+
+	if stamp {
+		if err := setVersion(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(result.Changes) > 0 || stamp {
+		text := parsed.String()
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+
+		result.Content = []byte(text)
+	}
+
+	return result, nil
+}
+
+// Outdated returns the config files loaded with the config which are older
+// than CurrentVersion.
+func (c *Config) Outdated() []*Migration {
+	return c.outdated
+}
+
+// configVersion returns the version of config, read from file.
+func configVersion(file string, config *ast.MappingNode) (int, error) {
+	for _, value := range config.Values {
+		if value.Key.GetToken().Value != "version" {
+			continue
+		}
+
+		version, err := strconv.Atoi(value.Value.GetToken().Value)
+		if err != nil || version < 1 {
+			return 0, fmt.Errorf("%s: version must be a whole number from 1 to %d, got %s",
+				file, CurrentVersion, value.Value.GetToken().Value)
+		}
+
+		if version > CurrentVersion {
+			return 0, fmt.Errorf("%s: version %d of the config is newer than this dfm supports, which is %d, update dfm to use it",
+				file, version, CurrentVersion)
+		}
+
+		return version, nil
+	}
+
+	return 1, nil
+}
+
+// setVersion sets the version key of config to CurrentVersion, adding it as
+// the first key if there isn't one.
+func setVersion(config *ast.MappingNode) error {
+	parsed, err := parser.ParseBytes(fmt.Appendf(nil, "version: %d\n", CurrentVersion), 0)
+	if err != nil {
+		return err
+	}
+
+	version := parsed.Docs[0].Body.(*ast.MappingNode).Values[0]
+	for _, value := range config.Values {
+		if value.Key.GetToken().Value == "version" {
+			_ = version.Value.SetComment(value.Value.GetComment())
+			value.Value = version.Value
+			return nil
+		}
+	}
+
+	// The comment above the first key usually describes the whole file so
+	// it stays at the top.
+	first := config.Values[0]
+	version.AddColumn(first.Key.GetToken().Position.Column - version.Key.GetToken().Position.Column)
+	if comment := first.GetComment(); comment != nil {
+		_ = version.SetComment(comment)
+		_ = first.SetComment(nil)
+	}
+
+	config.Values = append([]*ast.MappingValueNode{version}, config.Values...)
+	return nil
+}
+
+// migrateConfig applies m to config and each of its modules.
+func migrateConfig(m migration, config *ast.MappingNode, path string) []rename {
+	changes := m(config, path)
+	modules, ok := mappingValue(config, "modules").(*ast.SequenceNode)
+	if !ok {
+		return changes
+	}
+
+	for idx, value := range modules.Values {
+		if module, ok := value.(*ast.MappingNode); ok {
+			changes = append(changes, migrateConfig(m, module, fmt.Sprintf("%smodules[%d].", path, idx))...)
+		}
+	}
+
+	return changes
+}
+
+// migrateLegacyNames renames the before_ and after_ hooks of older versions of
+// dfm to the pre_ and post_ hooks which replaced them, and the repo key of
+// modules to repository.
+func migrateLegacyNames(config *ast.MappingNode, path string) []rename {
+	changes := []rename{}
+	if path != "" {
+		if change, ok := renameKey(config, path, "repo", "repository"); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	hookMap, ok := mappingValue(config, "hooks").(*ast.MappingNode)
+	if !ok {
+		return changes
+	}
+
+	replacer := strings.NewReplacer("before_", "pre_", "after_", "post_")
+	for _, value := range hookMap.Values {
+		name := value.Key.GetToken().Value
+		renamed := replacer.Replace(name)
+		if renamed == name || !slices.Contains(hooks.Names, renamed) {
+			continue
+		}
+
+		if change, ok := renameKey(hookMap, path+"hooks.", name, renamed); ok {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// renameKey renames the key from of config, at path, to to. It reports
+// whether config has from, nothing is renamed when config already has to
+// which the rename records as a conflict.
+func renameKey(config *ast.MappingNode, path, from, to string) (rename, bool) {
+	r := rename{path: path, from: from, to: to}
+	var key *ast.StringNode
+	for _, value := range config.Values {
+		switch value.Key.GetToken().Value {
+		case to:
+			r.conflict = true
+		case from:
+			key, _ = value.Key.(*ast.StringNode)
+		}
+	}
+
+	if key == nil {
+		return r, false
+	}
+
+	if !r.conflict {
+		key.Value = to
+		key.Token.Value = to
+		key.Token.Origin = to
+	}
+
+	return r, true
+}
+
+// undoRenames renames the keys renames renamed in content back to what they
+// were, content being a config marshaled from a migrated file. Saving that
+// config leaves the file's own keys as they were, only dfm config migrate
+// renames them.
+func undoRenames(content []byte, renames []rename) ([]byte, error) {
+	if len(renames) == 0 {
+		return content, nil
+	}
+
+	parsed, err := parser.ParseBytes(content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsed.Docs) != 1 {
+		return content, nil
+	}
+
+	config, ok := parsed.Docs[0].Body.(*ast.MappingNode)
+	if !ok {
+		return content, nil
+	}
+
+	for _, r := range renames {
+		if r.conflict {
+			continue
+		}
+
+		if parent := mappingAt(config, r.path); parent != nil {
+			renameKey(parent, r.path, r.to, r.from)
+		}
+	}
+
+	return []byte(parsed.String() + "\n"), nil
+}
+
+// mappingAt returns the mapping path, such as modules[0].hooks., locates in
+// config or nil if there isn't one.
+func mappingAt(config *ast.MappingNode, path string) *ast.MappingNode {
+	for _, part := range strings.Split(strings.TrimSuffix(path, "."), ".") {
+		if part == "" {
+			continue
+		}
+
+		key, idx, indexed := strings.Cut(strings.TrimSuffix(part, "]"), "[")
+		node := mappingValue(config, key)
+		if indexed {
+			seq, ok := node.(*ast.SequenceNode)
+			n, err := strconv.Atoi(idx)
+			if !ok || err != nil || n >= len(seq.Values) {
+				return nil
+			}
+
+			node = seq.Values[n]
+		}
+
+		mapping, ok := node.(*ast.MappingNode)
+		if !ok {
+			return nil
+		}
+
+		config = mapping
+	}
+
+	return config
+}
+
+// mappingValue returns the value of key in config, or nil.
+func mappingValue(config *ast.MappingNode, key string) ast.Node {
+	for _, value := range config.Values {
+		if value.Key.GetToken().Value == key {
+			return value.Value
+		}
+	}
+
+	return nil
+}
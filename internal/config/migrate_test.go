@@ -0,0 +1,220 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+const legacyConfig = `# My dotfiles
+hooks:
+  # Runs before pulling.
+  before_sync:
+    - echo syncing # trailing
+  after_link:
+    - echo linked
+modules:
+  - repo: https://example.com/work.git
+    hooks:
+      after_sync:
+        - echo work
+`
+
+func TestMigrationsReachCurrentVersion(t *testing.T) {
+	t.Parallel()
+
+	for version := 2; version <= CurrentVersion; version++ {
+		if migrations[version] == nil {
+			t.Fatalf("no migration to version %d", version)
+		}
+	}
+}
+
+func TestMigrateRenamesLegacyKeys(t *testing.T) {
+	t.Parallel()
+
+	migrated, err := Migrate(".dfm.yml", []byte(legacyConfig), true)
+	if err != nil {
+		t.Fatalf("Migrate returned error: %v", err)
+	}
+
+	want := strings.NewReplacer(
+		"# My dotfiles\n", "# My dotfiles\nversion: 2\n",
+		"before_sync", "pre_sync",
+		"after_link", "post_link",
+		"after_sync", "post_sync",
+		"repo:", "repository:",
+	).Replace(legacyConfig)
+
+	if string(migrated.Content) != want {
+		t.Fatalf("expected the keys to be renamed in place, got:\n%s\nwant:\n%s", migrated.Content, want)
+	}
+
+	changes := []string{
+		"hooks.before_sync renamed to pre_sync",
+		"hooks.after_link renamed to post_link",
+		"modules[0].repo renamed to repository",
+		"modules[0].hooks.after_sync renamed to post_sync",
+	}
+
+	if migrated.From != 1 || migrated.To != CurrentVersion || !slices.Equal(migrated.Changes, changes) {
+		t.Fatalf("unexpected migration: %+v", migrated)
+	}
+
+	again, err := Migrate(".dfm.yml", migrated.Content, true)
+	if err != nil || again.From != CurrentVersion || string(again.Content) != want {
+		t.Fatalf("expected a migrated config to be left alone, got %+v, %v", again, err)
+	}
+}
+
+func TestMigrateKeepsConflictingKeys(t *testing.T) {
+	t.Parallel()
+
+	content := "version: 1\nhooks:\n  before_sync:\n    - echo old\n  pre_sync:\n    - echo new\n"
+	migrated, err := Migrate(".dfm.yml", []byte(content), true)
+	if err != nil {
+		t.Fatalf("Migrate returned error: %v", err)
+	}
+
+	if want := strings.Replace(content, "version: 1", "version: 2", 1); string(migrated.Content) != want {
+		t.Fatalf("expected only the version to change, got:\n%s", migrated.Content)
+	}
+
+	if len(migrated.Changes) != 1 || !strings.Contains(migrated.Changes[0], "merge them by hand") {
+		t.Fatalf("expected the conflict to be reported, got %v", migrated.Changes)
+	}
+}
+
+func TestMigrateRejectsUnsupportedVersions(t *testing.T) {
+	t.Parallel()
+
+	for content, want := range map[string]string{
+		"version: 99\n":  "newer than this dfm supports",
+		"version: 0\n":   "must be a whole number",
+		"version: two\n": "must be a whole number",
+	} {
+		if _, err := Migrate(".dfm.yml", []byte(content), false); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected an error containing %q for %q, got %v", want, content, err)
+		}
+	}
+}
+
+func TestLoadMigratesLegacyConfig(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".dfm.yml":      "include:\n  - hooks.yml\n" + legacyConfig,
+		"hooks.yml":     "version: 2\nhooks:\n  pre_link:\n    - echo included\n",
+		LocalConfigFile: "hooks:\n  after_sync:\n    - echo local\n",
+	})
+
+	configFile := filepath.Join(dir, ".dfm.yml")
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if len(cfg.Hooks["pre_sync"]) != 1 || len(cfg.Hooks["post_sync"]) != 1 || len(cfg.Hooks["pre_link"]) != 1 {
+		t.Fatalf("expected the legacy hooks to be renamed, got %v", cfg.Hooks)
+	}
+
+	if cfg.Modules[0].Repo != "https://example.com/work.git" || len(cfg.Modules[0].Hooks["post_sync"]) != 1 {
+		t.Fatalf("expected the legacy module keys to be renamed, got %+v", cfg.Modules[0])
+	}
+
+	files := []string{}
+	for _, outdated := range cfg.Outdated() {
+		files = append(files, filepath.Base(outdated.File))
+	}
+
+	if !slices.Equal(files, []string{".dfm.yml", LocalConfigFile}) {
+		t.Fatalf("expected the files without a version to be outdated, got %v", files)
+	}
+
+	warnings := 0
+	for _, problem := range cfg.Validate() {
+		if problem.Path != "version" || !problem.Warning {
+			t.Fatalf("unexpected problem: %s", problem)
+		}
+
+		warnings++
+	}
+
+	if warnings != 5 {
+		t.Fatalf("expected a warning for each renamed key, got %d", warnings)
+	}
+}
+
+func TestLoadRejectsNewerConfig(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	Lenient = true
+	t.Cleanup(func() { Lenient = false })
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".dfm.yml":  "include:\n  - newer.yml\n",
+		"newer.yml": "version: 3\nsome_new_setting: true\n",
+	})
+
+	_, err := Load(filepath.Join(dir, ".dfm.yml"))
+	if err == nil || !strings.Contains(err.Error(), "newer.yml: version 3") {
+		t.Fatalf("expected a newer config to fail to load, got %v", err)
+	}
+}
+
+func TestSaveKeepsLegacyKeys(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ".dfm.yml")
+	writeFiles(t, dir, map[string]string{".dfm.yml": legacyConfig})
+
+	cfg, err := LoadCommitted(configFile)
+	if err != nil {
+		t.Fatalf("LoadCommitted returned error: %v", err)
+	}
+
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	if saved := readConfig(t, configFile); saved != legacyConfig {
+		t.Fatalf("expected saving an unchanged config to leave it alone, got:\n%s", saved)
+	}
+
+	cfg.Mappings = append(cfg.Mappings, &mapping.Mapping{Match: "README"})
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	saved := readConfig(t, configFile)
+	if !strings.Contains(saved, "match: README") {
+		t.Fatalf("expected the new mapping to be saved, got:\n%s", saved)
+	}
+
+	for _, key := range []string{"before_sync:", "after_link:", "after_sync:", "- repo:"} {
+		if !strings.Contains(saved, key) {
+			t.Fatalf("expected %s to be left for dfm config migrate, got:\n%s", key, saved)
+		}
+	}
+
+	if strings.Contains(saved, "version:") {
+		t.Fatalf("expected no version to be added, got:\n%s", saved)
+	}
+}
+
+func readConfig(t *testing.T, file string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	return string(content)
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// patchYAML returns original changed to hold the same values as updated,
+// which is t marshaled, touching only the nodes whose values differ so that
+// comments, key order and formatting elsewhere are kept. Keys in original
+// which t doesn't know about are kept as they are.
+func patchYAML(original, updated []byte, t reflect.Type) ([]byte, error) {
+	originalFile, err := parser.ParseBytes(original, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedFile, err := parser.ParseBytes(updated, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(originalFile.Docs) != 1 || originalFile.Docs[0].Body == nil ||
+		len(updatedFile.Docs) != 1 || updatedFile.Docs[0].Body == nil {
+		return updated, nil
+	}
+
+	// A file holding only comments keeps them above the new content.
+	if comments, ok := originalFile.Docs[0].Body.(*ast.CommentGroupNode); ok {
+		return []byte(comments.String() + "\n" + string(updated)), nil
+	}
+
+	doc := originalFile.Docs[0]
+	patched, ok := patchNode(doc.Body, updatedFile.Docs[0].Body, t)
+	if !ok {
+		return updated, nil
+	}
+
+	doc.Body = patched
+	text := originalFile.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+
+	return []byte(text), nil
+}
+
+// patchNode changes original in place to hold the value of updated where
+// they are both block mappings or sequences. It reports false when original
+// has to be replaced instead.
+func patchNode(original, updated ast.Node, t reflect.Type) (ast.Node, bool) {
+	if sameValue(original, updated) {
+		return original, true
+	}
+
+	switch o := original.(type) {
+	case *ast.MappingNode:
+		if u, ok := updated.(*ast.MappingNode); ok && !o.IsFlowStyle && len(o.Values) > 0 {
+			patchMapping(o, u, t)
+			return o, true
+		}
+	case *ast.SequenceNode:
+		if u, ok := updated.(*ast.SequenceNode); ok && !o.IsFlowStyle && len(o.Values) > 0 {
+			patchSequence(o, u, elemType(t))
+			return o, true
+		}
+	}
+
+	return nil, false
+}
+
+func patchMapping(original, updated *ast.MappingNode, t reflect.Type) {
+	byKey := map[string]*ast.MappingValueNode{}
+	for _, value := range updated.Values {
+		byKey[value.Key.GetToken().Value] = value
+	}
+
+	// New keys are indented like the keys already there.
+	column := original.Values[0].Key.GetToken().Position.Column
+
+	values := make([]*ast.MappingValueNode, 0, len(original.Values))
+	// The comment above the first key usually describes the whole file so
+	// it is kept when that key is removed.
+	var orphaned *ast.CommentGroupNode
+	for idx, value := range original.Values {
+		key := value.Key.GetToken().Value
+		fieldType, known := keyType(t, key)
+		replacement, ok := byKey[key]
+		if !ok {
+			// A key t doesn't know about was never marshaled, a key it
+			// does know about was left out because it is now empty.
+			if !known {
+				values = append(values, value)
+			} else if idx == 0 && value.GetComment() != nil {
+				orphaned = value.GetComment()
+			}
+
+			continue
+		}
+
+		delete(byKey, key)
+		values = append(values, patchValue(value, replacement, fieldType))
+	}
+
+	for _, value := range updated.Values {
+		if _, added := byKey[value.Key.GetToken().Value]; added {
+			value.AddColumn(column - value.Key.GetToken().Position.Column)
+			values = append(values, value)
+		}
+	}
+
+	if orphaned != nil && len(values) > 0 {
+		if existing := values[0].GetComment(); existing != nil {
+			orphaned.Comments = append(orphaned.Comments, existing.Comments...)
+		}
+
+		_ = values[0].SetComment(orphaned)
+	}
+
+	original.Values = values
+}
+
+// patchValue returns original with the value of updated, which has the same
+// key.
+func patchValue(original, updated *ast.MappingValueNode, t reflect.Type) *ast.MappingValueNode {
+	if patched, ok := patchNode(original.Value, updated.Value, t); ok {
+		original.Value = patched
+		return original
+	}
+
+	_, originalScalar := original.Value.(ast.ScalarNode)
+	_, updatedScalar := updated.Value.(ast.ScalarNode)
+	if originalScalar && updatedScalar {
+		_ = updated.Value.SetComment(original.Value.GetComment())
+		original.Value = updated.Value
+		return original
+	}
+
+	// The whole entry is replaced so the key and value are indented
+	// consistently, keeping the comments on the original.
+	updated.AddColumn(original.Key.GetToken().Position.Column - updated.Key.GetToken().Position.Column)
+	_ = updated.SetComment(original.GetComment())
+	updated.FootComment = original.FootComment
+	return updated
+}
+
+// patchSequence changes original to hold the values of updated. Entries
+// which are unchanged are kept as they are, along with their comments, and
+// entries changed in place are patched.
+func patchSequence(original, updated *ast.SequenceNode, t reflect.Type) {
+	headComments := len(original.ValueHeadComments) == len(original.Values)
+	column := original.Start.Position.Column - updated.Start.Position.Column
+
+	values := []ast.Node{}
+	comments := []*ast.CommentGroupNode{}
+	sources := []int{}
+	comment := func(idx int) *ast.CommentGroupNode {
+		if idx < 0 || !headComments {
+			return nil
+		}
+
+		return original.ValueHeadComments[idx]
+	}
+
+	// add adds value in place of the original entry at idx, which is -1 for
+	// entries which are new.
+	add := func(idx int, value ast.Node, isNew bool) {
+		if isNew {
+			value.AddColumn(column)
+		}
+
+		values = append(values, value)
+		comments = append(comments, comment(idx))
+		sources = append(sources, idx)
+	}
+
+	matches := commonEntries(original.Values, updated.Values)
+	from, to := 0, 0
+	for _, match := range append(matches, [2]int{len(original.Values), len(updated.Values)}) {
+		// Entries between two unchanged ones are paired up and patched,
+		// whatever is left over was removed or added.
+		for from < match[0] && to < match[1] {
+			if patched, ok := patchNode(original.Values[from], updated.Values[to], t); ok {
+				add(from, patched, false)
+			} else {
+				add(from, updated.Values[to], true)
+			}
+
+			from++
+			to++
+		}
+
+		for ; to < match[1]; to++ {
+			add(-1, updated.Values[to], true)
+		}
+
+		if match[0] < len(original.Values) {
+			add(match[0], original.Values[match[0]], false)
+		}
+
+		from, to = match[0]+1, match[1]+1
+	}
+
+	// The comment above the first entry belongs to the sequence rather
+	// than the entry so it goes if the entry does.
+	if len(sources) == 0 || sources[0] != 0 {
+		original.Comment = nil
+	}
+
+	original.Values = values
+	original.ValueHeadComments = nil
+	if headComments {
+		original.ValueHeadComments = comments
+	}
+}
+
+// commonEntries returns the index pairs of the longest run of entries, in
+// order, which have the same value in both original and updated.
+func commonEntries(original, updated []ast.Node) [][2]int {
+	lengths := make([][]int, len(original)+1)
+	for idx := range lengths {
+		lengths[idx] = make([]int, len(updated)+1)
+	}
+
+	for i := len(original) - 1; i >= 0; i-- {
+		for j := len(updated) - 1; j >= 0; j-- {
+			if sameValue(original[i], updated[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	matches := [][2]int{}
+	for i, j := 0, 0; i < len(original) && j < len(updated); {
+		switch {
+		case sameValue(original[i], updated[j]):
+			matches = append(matches, [2]int{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return matches
+}
+
+// sameValue reports whether a and b decode to the same value, treating empty
+// values as if they weren't set.
+func sameValue(a, b ast.Node) bool {
+	var aValue, bValue any
+	if err := yaml.NodeToValue(a, &aValue); err != nil {
+		return false
+	}
+
+	if err := yaml.NodeToValue(b, &bValue); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(withoutEmpty(aValue), withoutEmpty(bValue))
+}
+
+// withoutEmpty returns value with the empty values of maps removed.
+func withoutEmpty(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		cleaned := map[string]any{}
+		for key, entry := range v {
+			entry = withoutEmpty(entry)
+			if entry != nil && !reflect.ValueOf(entry).IsZero() && !isEmptyCollection(entry) {
+				cleaned[key] = entry
+			}
+		}
+
+		return cleaned
+	case []any:
+		cleaned := make([]any, len(v))
+		for idx, entry := range v {
+			cleaned[idx] = withoutEmpty(entry)
+		}
+
+		return cleaned
+	}
+
+	return value
+}
+
+func isEmptyCollection(value any) bool {
+	v := reflect.ValueOf(value)
+	return (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0
+}
+
+// keyType returns the type of the value of key in a mapping decoded into t,
+// and whether t knows about key. Every key of a map is known, as is every
+// key when t is nil.
+func keyType(t reflect.Type, key string) (reflect.Type, bool) {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil {
+		return nil, true
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Struct:
+		for idx := range t.NumField() {
+			if name, ok := yamlKey(t.Field(idx)); ok && name == key {
+				return t.Field(idx).Type, true
+			}
+		}
+
+		return nil, false
+	}
+
+	return nil, true
+}
+
+// yamlKey returns the key field is decoded from, false if it isn't decoded.
+func yamlKey(field reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if !field.IsExported() || name == "-" {
+		return "", false
+	}
+
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name, true
+}
+
+// elemType returns the type of the entries of a sequence decoded into t.
+func elemType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return nil
+	}
+
+	return t.Elem()
+}
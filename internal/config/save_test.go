@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+const handWrittenConfig = `# My dotfiles
+pull_only: true # never push from this machine
+
+mappings:
+  # Editor config is linked as a whole.
+  - path: .vim
+    link_as_dir: true
+
+  # Notes stay in the repository.
+  - glob: "**/*.md"
+    skip: true
+
+modules:
+  - repository: https://github.com/me/work-dotfiles.git
+    link_mode: pre
+`
+
+// saveAndRead loads content as a .dfm.yml, lets edit change the config,
+// saves it and returns what was written.
+func saveAndRead(t *testing.T, content string, edit func(cfg *Config)) string {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	file := filepath.Join(t.TempDir(), ".dfm.yml")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(file)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	edit(cfg)
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	saved, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read saved config: %v", err)
+	}
+
+	if _, err := Load(file); err != nil {
+		t.Fatalf("failed to load saved config: %v\n%s", err, saved)
+	}
+
+	return string(saved)
+}
+
+func TestSaveWithoutChangesKeepsFile(t *testing.T) {
+	// Keys a newer dfm knows about are kept too.
+	Lenient = true
+	t.Cleanup(func() { Lenient = false })
+
+	content := handWrittenConfig + "unknown_setting: 1\n"
+	saved := saveAndRead(t, content, func(*Config) {})
+	if saved != content {
+		t.Fatalf("expected the file to be unchanged, got:\n%s", saved)
+	}
+}
+
+func TestSaveAddsMappingWithoutTouchingTheRest(t *testing.T) {
+	saved := saveAndRead(t, handWrittenConfig, func(cfg *Config) {
+		cfg.Mappings = append(cfg.Mappings, &mapping.Mapping{Path: ".emacs.d", LinkAsDir: true})
+	})
+
+	want := strings.Replace(
+		handWrittenConfig,
+		"    skip: true\n",
+		"    skip: true\n  - path: .emacs.d\n    link_as_dir: true\n",
+		1,
+	)
+
+	if saved != want {
+		t.Fatalf("expected only the new mapping to be added, got:\n%s\nwant:\n%s", saved, want)
+	}
+}
+
+func TestSaveRemovesMappingKeepingOtherComments(t *testing.T) {
+	saved := saveAndRead(t, handWrittenConfig, func(cfg *Config) {
+		cfg.Mappings = cfg.Mappings[1:]
+		cfg.PullOnly = false
+	})
+
+	for _, removed := range []string{".vim", "Editor config", "pull_only"} {
+		if strings.Contains(saved, removed) {
+			t.Fatalf("expected %q to be removed, got:\n%s", removed, saved)
+		}
+	}
+
+	for _, kept := range []string{"# My dotfiles\n", "  # Notes stay in the repository.\n", "    link_mode: pre\n"} {
+		if !strings.Contains(saved, kept) {
+			t.Fatalf("expected %q to be kept, got:\n%s", kept, saved)
+		}
+	}
+}
+
+func TestSaveNewFileOmitsEmptyFields(t *testing.T) {
+	saved := saveAndRead(t, "", func(cfg *Config) {
+		cfg.Mappings = append(cfg.Mappings, &mapping.Mapping{Path: ".vim", LinkAsDir: true})
+	})
+
+	if want := "version: 2\nmappings:\n- path: .vim\n  link_as_dir: true\n"; saved != want {
+		t.Fatalf("expected only the set fields to be written, got:\n%s", saved)
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/chasinglogic/dfm/internal/hooks"
+	"github.com/chasinglogic/dfm/internal/utils"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// Lenient makes Load ignore unknown keys and misspelled hook names, which
+// are otherwise errors, so that a config written for a newer version of dfm
+// can still be used.
+var Lenient bool
+
+// UnknownKeyError is a key in a config file which dfm doesn't know about,
+// such as a misspelled option, or a hook name which is likely a mistake for
+// one dfm runs.
+type UnknownKeyError struct {
+	File   string
+	Line   int
+	Column int
+	// Path locates the key in the file, for example
+	// modules[0].mappings[2].sikp.
+	Path string
+	Key  string
+	// Suggestion is the known key Key is most likely a mistake for, if any.
+	Suggestion string
+	// Hook is set when Key is the name of a hook.
+	Hook bool
+}
+
+func (e *UnknownKeyError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message())
+}
+
+// Message describes the problem without its location.
+func (e *UnknownKeyError) Message() string {
+	kind := "key"
+	if e.Hook {
+		kind = "hook"
+	}
+
+	message := fmt.Sprintf("unknown %s %q", kind, e.Key)
+	if e.Suggestion != "" {
+		message += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+
+	return message
+}
+
+var hooksType = reflect.TypeOf(hooks.Hooks{})
+
+// findUnknownKeys returns an UnknownKeyError for each key in content, the
+// YAML of file, which decoding it into t ignores. Hook names which aren't
+// run by dfm are only included if they look like a mistake for one which
+// is, others may be run with run-hook.
+func findUnknownKeys(file string, content []byte, t reflect.Type) ([]*UnknownKeyError, error) {
+	parsed, err := parser.ParseBytes(content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := []*UnknownKeyError{}
+	report := func(value *ast.MappingValueNode, path string, suggestion string, hook bool) {
+		position := value.Key.GetToken().Position
+		unknown = append(unknown, &UnknownKeyError{
+			File:       file,
+			Line:       position.Line,
+			Column:     position.Column,
+			Path:       path,
+			Key:        value.Key.GetToken().Value,
+			Suggestion: suggestion,
+			Hook:       hook,
+		})
+	}
+
+	var walk func(node ast.Node, t reflect.Type, path string)
+	walk = func(node ast.Node, t reflect.Type, path string) {
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		switch n := node.(type) {
+		case *ast.MappingNode:
+			for _, value := range n.Values {
+				key := value.Key.GetToken().Value
+				keyPath := key
+				if path != "" {
+					keyPath = path + "." + key
+				}
+
+				if value.Key.IsMergeKey() {
+					continue
+				}
+
+				if t == hooksType {
+					if suggestion := hooks.Suggest(key); suggestion != "" {
+						report(value, keyPath, suggestion, true)
+					}
+
+					continue
+				}
+
+				fieldType, known := keyType(t, key)
+				if !known {
+					report(value, keyPath, utils.Closest(key, structKeys(t)), false)
+					continue
+				}
+
+				walk(value.Value, fieldType, keyPath)
+			}
+		case *ast.SequenceNode:
+			for idx, value := range n.Values {
+				walk(value, elemType(t), fmt.Sprintf("%s[%d]", path, idx))
+			}
+		}
+	}
+
+	for _, doc := range parsed.Docs {
+		walk(doc.Body, t, "")
+	}
+
+	return unknown, nil
+}
+
+// structKeys returns the keys a mapping decoded into the struct t may have.
+func structKeys(t reflect.Type) []string {
+	keys := []string{}
+	if t == nil || t.Kind() != reflect.Struct {
+		return keys
+	}
+
+	for idx := range t.NumField() {
+		if name, ok := yamlKey(t.Field(idx)); ok {
+			keys = append(keys, name)
+		}
+	}
+
+	return keys
+}
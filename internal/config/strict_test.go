@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	content := `prompt_for_comit_message: true
+mappings:
+  - match: foo
+    sikp: true
+modules:
+  - repository: https://example.com/foo.git
+    pul_only: true
+llm:
+  model_provider: openai
+  modle: gpt
+hooks:
+  before_sync:
+    - echo syncing
+  deploy:
+    - echo deploying
+  pre_sync:
+    - echo syncing
+`
+
+	unknown, err := findUnknownKeys(".dfm.yml", []byte(content), reflect.TypeOf(Config{}))
+	if err != nil {
+		t.Fatalf("findUnknownKeys returned error: %v", err)
+	}
+
+	want := []UnknownKeyError{
+		{File: ".dfm.yml", Line: 1, Column: 1, Path: "prompt_for_comit_message", Key: "prompt_for_comit_message", Suggestion: "prompt_for_commit_message"},
+		{File: ".dfm.yml", Line: 4, Column: 5, Path: "mappings[0].sikp", Key: "sikp", Suggestion: "skip"},
+		{File: ".dfm.yml", Line: 7, Column: 5, Path: "modules[0].pul_only", Key: "pul_only", Suggestion: "pull_only"},
+		{File: ".dfm.yml", Line: 10, Column: 3, Path: "llm.modle", Key: "modle", Suggestion: "model"},
+		{File: ".dfm.yml", Line: 12, Column: 3, Path: "hooks.before_sync", Key: "before_sync", Suggestion: "pre_sync", Hook: true},
+	}
+
+	if len(unknown) != len(want) {
+		t.Fatalf("findUnknownKeys found %d keys, want %d: %+v", len(unknown), len(want), unknown)
+	}
+
+	for idx := range want {
+		if *unknown[idx] != want[idx] {
+			t.Fatalf("unknown key %d is %+v, want %+v", idx, *unknown[idx], want[idx])
+		}
+	}
+}
+
+func TestLoadReportsUnknownKeys(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	configFile := filepath.Join(t.TempDir(), ".dfm.yml")
+	content := "mappings:\n  - match: foo\n    sikp: true\n"
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configFile)
+
+	var unknownErr *UnknownKeyError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("expected an UnknownKeyError, got %v", err)
+	}
+
+	if unknownErr.Path != "mappings[0].sikp" || unknownErr.Line != 3 {
+		t.Fatalf("unexpected UnknownKeyError: %+v", unknownErr)
+	}
+
+	if cfg == nil || len(cfg.Mappings) != 1 {
+		t.Fatalf("expected the config to be loaded anyway, got %+v", cfg)
+	}
+
+	problems := cfg.Validate()
+	if len(problems) != 1 || problems[0].Path != "mappings[0].sikp" || problems[0].Warning {
+		t.Fatalf("expected Validate to report the unknown key as an error, got %+v", problems)
+	}
+}
+
+func TestLoadLenientIgnoresUnknownKeys(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	Lenient = true
+	t.Cleanup(func() { Lenient = false })
+
+	configFile := filepath.Join(t.TempDir(), ".dfm.yml")
+	content := "newer_setting: true\nhooks:\n  after_sync:\n    - echo synced\n"
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	for _, problem := range cfg.Validate() {
+		if !problem.Warning {
+			t.Fatalf("expected only warnings when lenient, got %+v", problem)
+		}
+	}
+}
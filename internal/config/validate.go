@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/condition"
+	"github.com/chasinglogic/dfm/internal/hooks"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+// MappingError is returned by Load when the pattern of a mapping is invalid,
+// such as a match regular expression which does not compile.
+type MappingError struct {
+	// File is the config file the mapping is in.
+	File string
+	// Path locates the mapping in the file, for example
+	// modules[0].mappings[2].
+	Path string
+	// Pattern is the match, glob or path of the mapping.
+	Pattern string
+	Err     error
+}
+
+func (e *MappingError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.File, e.Path, e.Err)
+}
+
+func (e *MappingError) Unwrap() error {
+	return e.Err
+}
+
+// Problem is something wrong with a config file found by Validate.
+type Problem struct {
+	File    string
+	Path    string
+	Message string
+	// Warning is set for problems which don't stop the profile from being
+	// linked.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	kind := "error"
+	if p.Warning {
+		kind = "warning"
+	}
+
+	return fmt.Sprintf("%s: %s: %s: %s", p.File, kind, p.Path, p.Message)
+}
+
+// compileMappings compiles the mappings of c and its modules, returning a
+// MappingError for each which doesn't compile.
+func (c *Config) compileMappings() error {
+	errs := []error{}
+	c.walk("", func(cfg *Config, prefix string) {
+		for idx, m := range cfg.Mappings {
+			path := fmt.Sprintf("%smappings[%d]", prefix, idx)
+			if err := m.Compile(); err != nil {
+				errs = append(errs, &MappingError{
+					File:    c.Origin(path),
+					Path:    path,
+					Pattern: m.Pattern(),
+					Err:     err,
+				})
+			}
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// walk calls fn with c and each of its modules, recursively, along with the
+// path prefix locating them in the config file.
+func (c *Config) walk(prefix string, fn func(cfg *Config, prefix string)) {
+	fn(c, prefix)
+	for idx := range c.Modules {
+		c.Modules[idx].walk(fmt.Sprintf("%smodules[%d].", prefix, idx), fn)
+	}
+}
+
+// Validate checks the config and its modules for mistakes which would stop
+// them from linking as intended.
+func (c *Config) Validate() []Problem {
+	problems := []Problem{}
+	report := func(path string, warning bool, format string, args ...any) {
+		problems = append(problems, Problem{
+			File:    c.Origin(path),
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+			Warning: warning,
+		})
+	}
+
+	for _, unknown := range c.unknownKeys {
+		if !unknown.Hook {
+			problems = append(problems, Problem{
+				File:    unknown.File,
+				Path:    unknown.Path,
+				Message: fmt.Sprintf("line %d: %s", unknown.Line, unknown.Message()),
+				Warning: Lenient,
+			})
+		}
+	}
+
+	// Outdated files still load the same, they only need migrating when
+	// something in them was renamed.
+	for _, migrated := range c.outdated {
+		for _, change := range migrated.Changes {
+			problems = append(problems, Problem{
+				File:    migrated.File,
+				Path:    "version",
+				Message: fmt.Sprintf("version %d is outdated, %s, run dfm config migrate --write", migrated.From, change),
+				Warning: true,
+			})
+		}
+	}
+
+	c.walk("", func(cfg *Config, prefix string) {
+		if err := cfg.When.Validate(); err != nil {
+			report(prefix+"when", false, "%v", err)
+		}
+
+		// Modules are part of their parent's file so only the top of the
+		// file can include others or extend a profile.
+		if prefix != "" && len(cfg.Include) > 0 {
+			report(prefix+"include", false, "modules can't include files, include them at the top of the file")
+		}
+
+		if prefix == "" && cfg.When != nil {
+			report("when", false, "only modules can have a when condition, the profile itself is always linked, move what should only apply on some machines into a module")
+		}
+
+		if prefix != "" && cfg.Version != 0 {
+			report(prefix+"version", false, "modules don't have a version, it is set at the top of the file")
+		}
+
+		if prefix != "" && cfg.Extends != "" {
+			report(prefix+"extends", false, "modules can't extend a profile, extend it at the top of the file")
+		}
+
+		if cfg.LinkStrategy != "" && !mapping.ValidStrategy(cfg.LinkStrategy) {
+			report(prefix+"link_strategy", false, "unknown link strategy %q, must be one of %s",
+				cfg.LinkStrategy, strings.Join(mapping.Strategies, ", "))
+		}
+
+		for _, target := range cfg.LinkTargets() {
+			if _, err := mapping.ResolveRoot(target.Root, "/"); err != nil {
+				report(fmt.Sprintf("%stargets.%s", prefix, target.Dir), false, "%v", err)
+			}
+		}
+
+		for idx, m := range cfg.Mappings {
+			validateMapping(fmt.Sprintf("%smappings[%d]", prefix, idx), m, report)
+		}
+
+		names := make([]string, 0, len(cfg.Hooks))
+		for name := range cfg.Hooks {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+		for _, name := range names {
+			path := fmt.Sprintf("%shooks.%s", prefix, name)
+			if err := cfg.Hooks.Validate(name); err != nil {
+				report(path, false, "%v", err)
+			}
+
+			if slices.Contains(hooks.Names, name) {
+				continue
+			}
+
+			// A hook named like one dfm runs is most likely a mistake,
+			// any other may be meant for run-hook.
+			if suggestion := hooks.Suggest(name); suggestion != "" {
+				report(path, Lenient, "unknown hook %q, did you mean %q?", name, suggestion)
+			} else {
+				report(path, true, "unknown hook %q only runs with run-hook", name)
+			}
+		}
+	})
+
+	return problems
+}
+
+func validateMapping(path string, m *mapping.Mapping, report func(string, bool, string, ...any)) {
+	if err := m.Compile(); err != nil {
+		report(path, false, "%v", err)
+	}
+
+	if m.Skip && (m.Dest != "" || m.LinkAsDir || m.TargetRoot != "" || m.LinkStrategy != "" || m.Template) {
+		report(path, false, "skip can not be combined with dest, link_as_dir, target_root, link_strategy or template")
+	}
+
+	if m.LinkAsDir && m.Dest != "" {
+		report(path, false, "link_as_dir and dest can not be used together")
+	}
+
+	if m.TargetRoot != "" && m.Dest != "" {
+		report(path, false, "target_root and dest can not be used together")
+	}
+
+	if m.TargetOS != "" && !mapping.ValidTargetOS(m.TargetOS) {
+		report(path, false, "unknown target_os %q, must be one of %s", m.TargetOS, strings.Join(condition.KnownOS, ", "))
+	}
+
+	if err := m.When.Validate(); err != nil {
+		report(path+".when", false, "%v", err)
+	}
+
+	if m.LinkStrategy != "" && !mapping.ValidStrategy(m.LinkStrategy) {
+		report(path, false, "unknown link strategy %q, must be one of %s",
+			m.LinkStrategy, strings.Join(mapping.Strategies, ", "))
+	}
+
+	if m.TargetRoot != "" {
+		if _, err := mapping.ResolveRoot(m.TargetRoot, "/"); err != nil {
+			report(path, false, "%v", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestLoadReportsInvalidModuleMapping(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, ".dfm.yml")
+
+	content := `mappings:
+  - match: ok
+modules:
+  - repository: https://example.com/foo.git
+    mappings:
+      - match: fine
+      - match: "broken("
+`
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	_, err := Load(configFile)
+
+	var mappingErr *MappingError
+	if !errors.As(err, &mappingErr) {
+		t.Fatalf("expected a MappingError, got %v", err)
+	}
+
+	if mappingErr.File != configFile || mappingErr.Path != "modules[0].mappings[1]" || mappingErr.Pattern != "broken(" {
+		t.Fatalf("unexpected MappingError: %+v", mappingErr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{}
+	content := `link_strategy: softlink
+when:
+  os: linux
+modules:
+  - repository: https://example.com/work.git
+    when:
+      os: linux
+targets:
+  home: home
+  etc: xdg_cache
+mappings:
+  - match: "("
+  - match: foo
+    skip: true
+    dest: /tmp/foo
+  - match: bar
+    target_os: Linux
+  - match: baz
+    target_os: beos
+  - match: qux
+    when:
+      os: macos
+hooks:
+  post_link:
+    - echo linked
+  after_sync:
+    - echo synced
+  pre_sync:
+    - 123
+`
+	if err := yaml.Unmarshal([]byte(content), cfg); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	problems := cfg.Validate()
+
+	want := map[string]bool{
+		"link_strategy":    false,
+		"when":             false,
+		"targets.etc":      false,
+		"mappings[0]":      false,
+		"mappings[1]":      false,
+		"mappings[3]":      false,
+		"mappings[4].when": false,
+		"hooks.after_sync": false,
+		"hooks.pre_sync":   false,
+	}
+
+	got := map[string]bool{}
+	for _, problem := range problems {
+		got[problem.Path] = problem.Warning
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Validate found problems with %v, want %v", got, want)
+	}
+
+	for path, warning := range want {
+		if isWarning, ok := got[path]; !ok || isWarning != warning {
+			t.Fatalf("expected a problem at %s with warning=%v, got %v", path, warning, got)
+		}
+	}
+
+	for _, problem := range problems {
+		if problem.Path == "hooks.after_sync" && !strings.Contains(problem.Message, `"post_sync"`) {
+			t.Fatalf("expected after_sync to suggest post_sync, got %q", problem.Message)
+		}
+	}
+}
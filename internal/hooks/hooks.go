@@ -3,9 +3,11 @@ package hooks
 import (
 	"errors"
 	"fmt"
-	"reflect"
+	"slices"
 	"strings"
 
+	"github.com/chasinglogic/dfm/internal/condition"
+	"github.com/chasinglogic/dfm/internal/logger"
 	"github.com/chasinglogic/dfm/internal/utils"
 )
 
@@ -15,6 +17,62 @@ var (
 
 type Hooks map[string][]any
 
+// Names are the hooks dfm runs itself, any other hook only runs with
+// run-hook.
+var Names = []string{"pre_link", "post_link", "pre_sync", "post_sync"}
+
+// Suggest returns the name of the hook dfm runs which name is most likely a
+// mistake for, such as pre_sync for the before_sync hook of older versions
+// of dfm or a misspelling, or "" if there isn't one.
+func Suggest(name string) string {
+	if slices.Contains(Names, name) {
+		return ""
+	}
+
+	replacer := strings.NewReplacer("before_", "pre_", "after_", "post_")
+	if renamed := replacer.Replace(name); slices.Contains(Names, renamed) {
+		return renamed
+	}
+
+	return utils.Closest(name, Names)
+}
+
+// Validate returns an error for the first hook named hookName which can't be
+// run.
+func (h Hooks) Validate(hookName string) error {
+	for idx, hook := range h[hookName] {
+		if _, err := parse(hook); err != nil {
+			return fmt.Errorf("%s[%d]: %w", hookName, idx, err)
+		}
+
+		when, err := hookCondition(hook)
+		if err == nil {
+			err = when.Validate()
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s[%d].when: %w", hookName, idx, err)
+		}
+	}
+
+	return nil
+}
+
+// hookCondition returns the when condition of a hook, nil if it has none.
+func hookCondition(hook any) (*condition.Condition, error) {
+	v, ok := hook.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	when, ok := v["when"]
+	if !ok {
+		return nil, nil
+	}
+
+	return condition.FromValue(when)
+}
+
 func (h Hooks) Execute(dir, hookName string) error {
 	value, ok := h[hookName]
 	if !ok {
@@ -22,6 +80,16 @@ func (h Hooks) Execute(dir, hookName string) error {
 	}
 
 	for _, hook := range value {
+		when, err := hookCondition(hook)
+		if err != nil {
+			return err
+		}
+
+		if !when.Matches() {
+			logger.Debug().Str("hook", hookName).Msg("skipping hook because its when condition does not match")
+			continue
+		}
+
 		args, err := parse(hook)
 		if err != nil {
 			return err
@@ -44,6 +112,8 @@ func parse(hook any) ([]string, error) {
 		switch interpreter := v["interpreter"].(type) {
 		case string:
 			args = append(args, strings.Split(interpreter, " ")...)
+		case nil:
+			args = append(args, "/bin/sh", "-c")
 		default:
 			return nil, ErrInvalidHook
 		}
@@ -57,7 +127,7 @@ func parse(hook any) ([]string, error) {
 
 		return args, nil
 	default:
-		fmt.Println(reflect.TypeOf(hook))
+		logger.Debug().Str("type", fmt.Sprintf("%T", hook)).Msg("invalid hook")
 		return nil, ErrInvalidHook
 	}
 }
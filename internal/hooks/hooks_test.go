@@ -73,3 +73,58 @@ func TestHooksExecuteRunsValidHook(t *testing.T) {
 		t.Fatalf("Execute returned error: %v", err)
 	}
 }
+
+func TestParseMapHookWithoutInterpreter(t *testing.T) {
+	args, err := parse(map[string]any{"script": "echo hello"})
+	if err != nil {
+		t.Fatalf("parse returned error: %v", err)
+	}
+
+	if len(args) != 3 || args[0] != "/bin/sh" || args[1] != "-c" || args[2] != "echo hello" {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+}
+
+func TestHooksExecuteSkipsUnmatchedWhen(t *testing.T) {
+	t.Setenv("DFM_TEST_HOOK", "")
+
+	h := Hooks{
+		"test": []any{
+			map[string]any{
+				"script": "false",
+				"when":   map[string]any{"env": "!DFM_TEST_HOOK"},
+			},
+		},
+	}
+
+	if err := h.Execute(".", "test"); err != nil {
+		t.Fatalf("Execute ran a hook whose condition does not match: %v", err)
+	}
+
+	h["test"] = []any{
+		map[string]any{
+			"script": "false",
+			"when":   map[string]any{"env": "DFM_TEST_HOOK"},
+		},
+	}
+
+	if err := h.Execute(".", "test"); err == nil {
+		t.Fatal("expected Execute to run a hook whose condition matches")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	cases := map[string]string{
+		"pre_sync":    "",
+		"before_sync": "pre_sync",
+		"after_link":  "post_link",
+		"post_snyc":   "post_sync",
+		"deploy":      "",
+	}
+
+	for name, want := range cases {
+		if got := Suggest(name); got != want {
+			t.Fatalf("Suggest(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/state"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// Entry records a single link created by dfm.
+type Entry struct {
+	Target    string    `json:"target"`
+	Source    string    `json:"source"`
+	Profile   string    `json:"profile"`
+	Module    string    `json:"module,omitempty"`
+	Mapping   string    `json:"mapping,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Backup is the ID of the backup holding whatever dfm replaced with this
+	// link.
+	Backup string `json:"backup,omitempty"`
+	// CreatedDirs are the parent directories dfm had to create for this link.
+	CreatedDirs []string `json:"created_dirs,omitempty"`
+
+	// Strategy is the link strategy used to create the target, empty means
+	// a symlink.
+	Strategy string `json:"strategy,omitempty"`
+	// Checksum is the SHA-256 of a copied file as dfm last wrote it, it is
+	// used to tell whether the copy was changed since.
+	Checksum string `json:"checksum,omitempty"`
+	// Home is the directory the link was made in when it was not the user's
+	// home directory.
+	Home string `json:"home,omitempty"`
+}
+
+// Manifest is the record of every link dfm has created, keyed by the target
+// path of the link.
+type Manifest struct {
+	Links map[string]Entry `json:"links"`
+}
+
+func File() (string, error) {
+	d, err := state.DfmDir()
+	return filepath.Join(d, "manifest.json"), err
+}
+
+func Load() (*Manifest, error) {
+	m := &Manifest{Links: map[string]Entry{}}
+
+	file, err := File()
+	if err != nil {
+		return m, err
+	}
+
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(content, m); err != nil {
+		return m, err
+	}
+
+	if m.Links == nil {
+		m.Links = map[string]Entry{}
+	}
+
+	return m, nil
+}
+
+// Save atomically replaces the manifest file so that a crash part way through
+// a write never leaves a truncated manifest behind.
+func (m *Manifest) Save() error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := File()
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(file, content, 0644)
+}
+
+// Record adds or replaces the entry for e.Target. If the target was already
+// recorded as pointing at the same source the original creation time is kept.
+// The backup and created directories of an existing entry are always kept
+// since they describe what was there before dfm linked anything.
+func (m *Manifest) Record(e Entry) {
+	if existing, ok := m.Links[e.Target]; ok {
+		if existing.Source == e.Source {
+			e.CreatedAt = existing.CreatedAt
+		}
+
+		if e.Backup == "" {
+			e.Backup = existing.Backup
+		}
+
+		if len(e.CreatedDirs) == 0 {
+			e.CreatedDirs = existing.CreatedDirs
+		}
+	}
+
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	m.Links[e.Target] = e
+}
+
+func (m *Manifest) Get(target string) (Entry, bool) {
+	e, ok := m.Links[target]
+	return e, ok
+}
+
+func (m *Manifest) Remove(target string) {
+	delete(m.Links, target)
+}
+
+// Entries returns all entries sorted by target.
+func (m *Manifest) Entries() []Entry {
+	entries := make([]Entry, 0, len(m.Links))
+	for _, e := range m.Links {
+		entries = append(entries, e)
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	return entries
+}
+
+// ForProfile returns the entries created while linking the given profile,
+// including those created by its modules, sorted by target.
+func (m *Manifest) ForProfile(profile string) []Entry {
+	entries := []Entry{}
+	for _, e := range m.Entries() {
+		if e.Profile == profile {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// Owns reports whether target is still what dfm created: a symlink which
+// points where the manifest says dfm pointed it, a hard link to the source or
+// a copy which is unchanged since dfm last wrote it.
+func (e Entry) Owns() bool {
+	switch e.Strategy {
+	case mapping.StrategyCopy:
+		checksum, err := utils.Checksum(e.Target)
+		return err == nil && checksum == e.Checksum
+	case mapping.StrategyHardlink:
+		return utils.SameFile(e.Target, e.Source)
+	}
+
+	linkTarget, err := os.Readlink(e.Target)
+	if err != nil {
+		return false
+	}
+
+	return utils.ResolveLink(e.Target, linkTarget) == filepath.Clean(e.Source)
+}
+
+// Prune removes entries whose target is no longer a link dfm created. Copies
+// are kept for as long as they exist so that changes made to them can still
+// be detected.
+func (m *Manifest) Prune() []Entry {
+	pruned := []Entry{}
+	for _, e := range m.Entries() {
+		if e.Strategy == mapping.StrategyCopy {
+			if _, err := os.Lstat(e.Target); err == nil {
+				continue
+			}
+		}
+
+		if !e.Owns() {
+			pruned = append(pruned, e)
+			m.Remove(e.Target)
+		}
+	}
+
+	return pruned
+}
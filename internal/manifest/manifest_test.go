@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadReturnsEmptyManifestWhenNoFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	m, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if len(m.Links) != 0 {
+		t.Fatalf("expected no links, got %d", len(m.Links))
+	}
+}
+
+func TestSaveAndLoadRoundTrip(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	m, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	m.Record(Entry{
+		Target:  "/home/user/.bashrc",
+		Source:  "/profiles/me/.bashrc",
+		Profile: "/profiles/me",
+		Module:  "/modules/shell",
+		Mapping: `{"match":"bashrc"}`,
+	})
+
+	if err := m.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	entry, ok := loaded.Get("/home/user/.bashrc")
+	if !ok {
+		t.Fatal("expected entry to be loaded")
+	}
+
+	if entry.Source != "/profiles/me/.bashrc" || entry.Module != "/modules/shell" {
+		t.Fatalf("unexpected entry after round trip: %+v", entry)
+	}
+
+	if entry.CreatedAt.IsZero() {
+		t.Fatal("expected CreatedAt to be set")
+	}
+
+	file, err := File()
+	if err != nil {
+		t.Fatalf("File returned error: %v", err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(file), ".manifest.json-*"))
+	if err != nil {
+		t.Fatalf("Glob returned error: %v", err)
+	}
+
+	if len(matches) != 0 {
+		t.Fatalf("expected temporary files to be cleaned up, found %v", matches)
+	}
+}
+
+func TestRecordKeepsCreationTimeForSameSource(t *testing.T) {
+	m := &Manifest{Links: map[string]Entry{}}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m.Record(Entry{Target: "/t", Source: "/s", CreatedAt: created})
+	m.Record(Entry{Target: "/t", Source: "/s"})
+
+	if entry, _ := m.Get("/t"); !entry.CreatedAt.Equal(created) {
+		t.Fatalf("CreatedAt = %v, want %v", entry.CreatedAt, created)
+	}
+
+	m.Record(Entry{Target: "/t", Source: "/other"})
+
+	if entry, _ := m.Get("/t"); entry.CreatedAt.Equal(created) {
+		t.Fatal("expected CreatedAt to be reset when the source changes")
+	}
+}
+
+func TestForProfileAndPrune(t *testing.T) {
+	dir := t.TempDir()
+
+	owned := filepath.Join(dir, "owned")
+	repointed := filepath.Join(dir, "repointed")
+	missing := filepath.Join(dir, "missing")
+
+	if err := os.Symlink("/profiles/me/owned", owned); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+
+	if err := os.Symlink("/somewhere/else", repointed); err != nil {
+		t.Fatalf("failed to create link: %v", err)
+	}
+
+	m := &Manifest{Links: map[string]Entry{}}
+	m.Record(Entry{Target: owned, Source: "/profiles/me/owned", Profile: "/profiles/me"})
+	m.Record(Entry{Target: repointed, Source: "/profiles/me/repointed", Profile: "/profiles/me"})
+	m.Record(Entry{Target: missing, Source: "/profiles/other/missing", Profile: "/profiles/other"})
+
+	if got := len(m.ForProfile("/profiles/me")); got != 2 {
+		t.Fatalf("ForProfile returned %d entries, want 2", got)
+	}
+
+	pruned := m.Prune()
+	if len(pruned) != 2 {
+		t.Fatalf("Prune removed %d entries, want 2", len(pruned))
+	}
+
+	if _, ok := m.Get(owned); !ok {
+		t.Fatal("expected owned link to remain in manifest")
+	}
+}
@@ -0,0 +1,59 @@
+package mapping
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Defaults returns the built in mappings. They are applied before a profile's
+// own mappings and are matched against the slash separated path of a file
+// relative to the directory being linked so that they only apply at the top
+// of a profile, or of a target directory.
+//
+// Skip defaults stop a file from being linked at all. Translating defaults
+// only change where a file is linked, a profile's own mappings still decide
+// how it is linked.
+func Defaults() []*Mapping {
+	return []*Mapping{
+		{Match: `^README`, Relative: true, Skip: true},
+		{Match: `^LICENSE`, Relative: true, Skip: true},
+		{Match: `^\.gitignore$`, Relative: true, Skip: true},
+		{Match: `^\.ggitignore$`, Relative: true, translate: homeFile(".gitignore")},
+		{Match: `^\.?config(/|$)`, Relative: true, translate: underRoot(RootXDGConfig, 1)},
+		{Match: `^\.local/share(/|$)`, Relative: true, translate: underRoot(RootXDGData, 2)},
+		{Match: `^\.local/state(/|$)`, Relative: true, translate: underRoot(RootXDGState, 2)},
+	}
+}
+
+// Translate returns where the file at rel, relative to the dotfile directory,
+// is linked under home if m is a translating default. The bool reports
+// whether m translates paths.
+func (m *Mapping) Translate(rel, home string) (string, bool) {
+	if m.translate == nil {
+		return "", false
+	}
+
+	return m.translate(filepath.ToSlash(rel), home), true
+}
+
+// homeFile links a file to name in the home directory.
+func homeFile(name string) func(string, string) string {
+	return func(_, home string) string {
+		return filepath.Join(home, name)
+	}
+}
+
+// underRoot links the contents of a directory, made of the first depth
+// components of a path, into the named target root. It is used with the
+// XDG roots, which always resolve.
+func underRoot(name string, depth int) func(string, string) string {
+	return func(rel, home string) string {
+		root, _ := ResolveRoot(name, home)
+		parts := strings.SplitN(rel, "/", depth+1)
+		if len(parts) <= depth {
+			return root
+		}
+
+		return filepath.Join(root, filepath.FromSlash(parts[depth]))
+	}
+}
@@ -0,0 +1,73 @@
+package mapping
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func matchDefault(rel string) *Mapping {
+	for _, m := range Defaults() {
+		if m.IsMatch("/profile/"+rel, rel) {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func TestDefaultsSkipRepositoryFiles(t *testing.T) {
+	for _, rel := range []string{"README", "README.md", "README.rst", "LICENSE", "LICENSE.txt", ".gitignore"} {
+		m := matchDefault(rel)
+		if m == nil || m.Action() != ActionSkip {
+			t.Fatalf("expected %s to be skipped by default, got %v", rel, m)
+		}
+	}
+
+	for _, rel := range []string{".bashrc", ".config/nvim/README.md", "docs/LICENSE", ".gitignore_global"} {
+		if m := matchDefault(rel); m != nil && m.Action() == ActionSkip {
+			t.Fatalf("expected %s not to be skipped, matched %s", rel, m)
+		}
+	}
+}
+
+func TestDefaultsTranslateGlobalGitignore(t *testing.T) {
+	m := matchDefault(".ggitignore")
+	if m == nil {
+		t.Fatal("expected .ggitignore to match a default mapping")
+	}
+
+	target, ok := m.Translate(".ggitignore", "/home/me")
+	if !ok || target != filepath.Join("/home/me", ".gitignore") {
+		t.Fatalf("Translate = %q, %v, want /home/me/.gitignore", target, ok)
+	}
+}
+
+func TestDefaultsTranslateConfigIntoXDGConfigHome(t *testing.T) {
+	cases := map[string]string{
+		"config/nvim/init.lua":  "/xdg/nvim/init.lua",
+		".config/nvim/init.lua": "/xdg/nvim/init.lua",
+		"config":                "/xdg",
+	}
+
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	for rel, want := range cases {
+		m := matchDefault(rel)
+		if m == nil {
+			t.Fatalf("expected %s to match a default mapping", rel)
+		}
+
+		if target, ok := m.Translate(rel, "/home/me"); !ok || target != want {
+			t.Fatalf("Translate(%q) = %q, %v, want %q", rel, target, ok, want)
+		}
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if target, _ := matchDefault("config/git/config").Translate("config/git/config", "/home/me"); target != "/home/me/.config/git/config" {
+		t.Fatalf("expected ~/.config when XDG_CONFIG_HOME is not set, got %s", target)
+	}
+
+	if m := matchDefault("configs/foo"); m != nil {
+		t.Fatalf("expected configs/foo not to match, matched %s", m)
+	}
+}
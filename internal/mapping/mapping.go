@@ -1,10 +1,18 @@
 package mapping
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/chasinglogic/dfm/internal/condition"
 )
 
 type Action int
@@ -24,6 +32,46 @@ func (a Action) String() string {
 	}
 }
 
+// The link strategies decide how a target is created from its source.
+const (
+	// StrategyAbsolute creates a symlink holding the absolute path of the
+	// source, it is the default.
+	StrategyAbsolute = "absolute"
+	// StrategySymlink is another name for StrategyAbsolute.
+	StrategySymlink = "symlink"
+	// StrategyRelative creates a symlink holding the path of the source
+	// relative to the directory of the target.
+	StrategyRelative = "relative"
+	// StrategyHardlink creates a hard link to the source.
+	StrategyHardlink = "hardlink"
+	// StrategyCopy copies the source to the target.
+	StrategyCopy = "copy"
+)
+
+// Strategies are the names of every link strategy.
+var Strategies = []string{
+	StrategyAbsolute,
+	StrategySymlink,
+	StrategyRelative,
+	StrategyHardlink,
+	StrategyCopy,
+}
+
+// ValidStrategy reports whether strategy is a known link strategy.
+func ValidStrategy(strategy string) bool {
+	return slices.Contains(Strategies, strategy)
+}
+
+// NormalizeStrategy returns the canonical name of strategy, "" and
+// StrategySymlink are StrategyAbsolute.
+func NormalizeStrategy(strategy string) string {
+	if strategy == "" || strategy == StrategySymlink {
+		return StrategyAbsolute
+	}
+
+	return strategy
+}
+
 const (
 	ActionNone = iota
 	ActionSkip
@@ -33,12 +81,39 @@ const (
 
 type Mapping struct {
 	rgx *regexp.Regexp `yaml:"-" json:"-"`
+	// translate is set for default mappings which change where a file is
+	// linked, see Translate.
+	translate func(rel, home string) string
 
-	Match     string `yaml:"match"`
-	LinkAsDir bool   `yaml:"link_as_dir"`
-	Skip      bool   `yaml:"skip"`
-	Dest      string `yaml:"dest"`
-	TargetOS  string `yaml:"target_os"`
+	// Match is a regular expression matched against the absolute path of a
+	// file, or its relative path when Relative is set.
+	Match string `yaml:"match,omitempty"`
+	// Glob is a glob, which may use ** to match any number of directories,
+	// matched against the slash separated path of a file relative to the
+	// dotfile directory.
+	Glob string `yaml:"glob,omitempty"`
+	// Path is the exact slash separated path of a file or directory
+	// relative to the dotfile directory.
+	Path string `yaml:"path,omitempty"`
+	// Relative matches Match against the relative path of a file so the
+	// mapping behaves the same wherever the profile is cloned.
+	Relative bool `yaml:"relative,omitempty"`
+
+	LinkAsDir bool   `yaml:"link_as_dir,omitempty"`
+	Skip      bool   `yaml:"skip,omitempty"`
+	Dest      string `yaml:"dest,omitempty"`
+	TargetOS  string `yaml:"target_os,omitempty"`
+	// When limits the mapping to machines matching the condition.
+	When *condition.Condition `yaml:"when,omitempty"`
+	// LinkStrategy overrides the profile's link strategy for matching
+	// files.
+	LinkStrategy string `yaml:"link_strategy,omitempty"`
+	// Template renders matching files as templates even without the .tmpl
+	// suffix.
+	Template bool `yaml:"template,omitempty"`
+	// TargetRoot is the named target root matching files are linked under
+	// instead of the home directory, see ResolveRoot.
+	TargetRoot string `yaml:"target_root,omitempty"`
 }
 
 func (m *Mapping) String() string {
@@ -50,14 +125,160 @@ func (m *Mapping) String() string {
 	return string(data)
 }
 
-func (m *Mapping) IsMatch(path string) bool {
+// Describe returns a short, single line description of the mapping such as
+// "glob **/*.md, skip".
+func (m *Mapping) Describe() string {
+	parts := []string{}
+	switch {
+	case m.Glob != "":
+		parts = append(parts, "glob "+m.Glob)
+	case m.Path != "":
+		parts = append(parts, "path "+m.Path)
+	case m.Match != "":
+		parts = append(parts, "match "+m.Match)
+	}
+
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{m.Relative, "relative"},
+		{m.Skip, "skip"},
+		{m.LinkAsDir, "link_as_dir"},
+		{m.Template, "template"},
+		{m.When != nil, "when"},
+	}
+
+	for _, flag := range flags {
+		if flag.set {
+			parts = append(parts, flag.name)
+		}
+	}
+
+	options := []struct {
+		name  string
+		value string
+	}{
+		{"dest", m.Dest},
+		{"target_os", m.TargetOS},
+		{"target_root", m.TargetRoot},
+		{"link_strategy", m.LinkStrategy},
+	}
+
+	for _, option := range options {
+		if option.value != "" {
+			parts = append(parts, option.name+" "+option.value)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "every path"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// ValidTargetOS reports whether os is a known target_os value, matching is
+// case insensitive.
+func ValidTargetOS(os string) bool {
+	return slices.Contains(condition.KnownOS, strings.ToLower(os))
+}
+
+// Pattern returns whichever of Match, Glob or Path the mapping uses.
+func (m *Mapping) Pattern() string {
+	return cmp.Or(m.Path, m.Glob, m.Match)
+}
+
+// Compile checks the pattern of the mapping, compiling its regular
+// expression, and returns an error if it is invalid. IsMatch compiles the
+// regular expression on first use otherwise.
+func (m *Mapping) Compile() error {
+	set := 0
+	for _, pattern := range []string{m.Match, m.Glob, m.Path} {
+		if pattern != "" {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return errors.New("only one of match, glob and path can be set")
+	}
+
+	switch {
+	case m.Path != "":
+		if cleaned := m.cleanPath(); cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("invalid path %q: must be inside the profile", m.Path)
+		}
+	case m.Glob != "":
+		if !doublestar.ValidatePattern(m.Glob) {
+			return fmt.Errorf("invalid glob %q", m.Glob)
+		}
+	default:
+		rgx, err := regexp.Compile(m.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match %q: %w", m.Match, err)
+		}
+
+		m.rgx = rgx
+	}
+
+	return nil
+}
+
+// cleanPath returns Path in the form it is compared with, a leading slash
+// refers to the top of the dotfile directory.
+func (m *Mapping) cleanPath() string {
+	return path.Clean(strings.TrimPrefix(m.Path, "/"))
+}
+
+// IsMatch reports whether the mapping applies to the file at path, rel is
+// the same file's slash separated path relative to the dotfile directory.
+func (m *Mapping) IsMatch(path, rel string) bool {
+	matched, _ := m.Check(path, rel)
+	return matched
+}
+
+// Check reports whether the mapping applies to the file at path, like
+// IsMatch, along with why not when it doesn't.
+func (m *Mapping) Check(path, rel string) (bool, string) {
+	isTargetOS := strings.ToLower(m.TargetOS) == runtime.GOOS || m.TargetOS == ""
+	if !isTargetOS {
+		return false, fmt.Sprintf("target_os %s does not match %s", m.TargetOS, runtime.GOOS)
+	}
+
+	if mismatch := m.When.Mismatch(); mismatch != "" {
+		return false, "when " + mismatch
+	}
+
+	switch {
+	case m.Path != "":
+		if rel != m.cleanPath() {
+			return false, fmt.Sprintf("path %s is not %s", m.cleanPath(), rel)
+		}
+
+		return true, ""
+	case m.Glob != "":
+		matched, err := doublestar.Match(strings.TrimPrefix(m.Glob, "/"), rel)
+		if err != nil || !matched {
+			return false, fmt.Sprintf("glob %s does not match %s", m.Glob, rel)
+		}
+
+		return true, ""
+	}
+
 	if m.rgx == nil {
 		m.rgx = regexp.MustCompile(m.Match)
 	}
 
-	matchesRegex := m.rgx.Match([]byte(path))
-	isTargetOS := strings.ToLower(m.TargetOS) == runtime.GOOS || m.TargetOS == ""
-	return matchesRegex && isTargetOS
+	if m.Relative {
+		path = rel
+	}
+
+	if !m.rgx.MatchString(path) {
+		return false, fmt.Sprintf("match %s does not match %s", m.Match, path)
+	}
+
+	return true, ""
 }
 
 func (m *Mapping) Action() Action {
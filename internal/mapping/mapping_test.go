@@ -3,6 +3,8 @@ package mapping
 import (
 	"runtime"
 	"testing"
+
+	"github.com/chasinglogic/dfm/internal/condition"
 )
 
 func notCurrentOS() string {
@@ -18,6 +20,7 @@ func TestIsMatch(t *testing.T) {
 		name     string
 		mapping  *Mapping
 		path     string
+		rel      string
 		expected bool
 	}{
 		{
@@ -70,11 +73,97 @@ func TestIsMatch(t *testing.T) {
 			path:     "foo",
 			expected: false,
 		},
+		{
+			name: "when match",
+			mapping: &Mapping{
+				Match: "foo",
+				When:  &condition.Condition{OS: condition.List{runtime.GOOS}},
+			},
+			path:     "foo",
+			expected: true,
+		},
+		{
+			name: "when mismatch",
+			mapping: &Mapping{
+				Match: "foo",
+				When:  &condition.Condition{OS: condition.List{"!" + runtime.GOOS}},
+			},
+			path:     "foo",
+			expected: false,
+		},
+		{
+			name:     "regex matches absolute path",
+			mapping:  &Mapping{Match: "^/home/me/dotfiles/bin/"},
+			path:     "/home/me/dotfiles/bin/tool",
+			rel:      "bin/tool",
+			expected: true,
+		},
+		{
+			name:     "relative regex match",
+			mapping:  &Mapping{Match: "^bin/", Relative: true},
+			path:     "/home/me/dotfiles/bin/tool",
+			rel:      "bin/tool",
+			expected: true,
+		},
+		{
+			name:     "relative regex ignores the profile location",
+			mapping:  &Mapping{Match: "dotfiles", Relative: true},
+			path:     "/home/me/dotfiles/bin/tool",
+			rel:      "bin/tool",
+			expected: false,
+		},
+		{
+			name:     "glob match",
+			mapping:  &Mapping{Glob: "**/*.md"},
+			path:     "/home/me/dotfiles/docs/notes/todo.md",
+			rel:      "docs/notes/todo.md",
+			expected: true,
+		},
+		{
+			name:     "glob star does not cross directories",
+			mapping:  &Mapping{Glob: "docs/*.md"},
+			path:     "/home/me/dotfiles/docs/notes/todo.md",
+			rel:      "docs/notes/todo.md",
+			expected: false,
+		},
+		{
+			name:     "path match",
+			mapping:  &Mapping{Path: ".config/nvim"},
+			path:     "/home/me/dotfiles/.config/nvim",
+			rel:      ".config/nvim",
+			expected: true,
+		},
+		{
+			name:     "path with leading slash",
+			mapping:  &Mapping{Path: "/.config/nvim/"},
+			path:     "/home/me/dotfiles/.config/nvim",
+			rel:      ".config/nvim",
+			expected: true,
+		},
+		{
+			name:     "path does not match children",
+			mapping:  &Mapping{Path: ".config/nvim"},
+			path:     "/home/me/dotfiles/.config/nvim/init.lua",
+			rel:      ".config/nvim/init.lua",
+			expected: false,
+		},
+		{
+			name:     "path does not match nested directories with the same name",
+			mapping:  &Mapping{Path: "nvim"},
+			path:     "/home/me/dotfiles/.config/nvim",
+			rel:      ".config/nvim",
+			expected: false,
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			if tc.mapping.IsMatch(tc.path) != tc.expected {
+			rel := tc.rel
+			if rel == "" {
+				rel = tc.path
+			}
+
+			if tc.mapping.IsMatch(tc.path, rel) != tc.expected {
 				t.Errorf("Expected %t, got %t", tc.expected, !tc.expected)
 			}
 		})
@@ -189,3 +278,31 @@ func TestAction(t *testing.T) {
 		})
 	}
 }
+
+func TestCompile(t *testing.T) {
+	valid := []*Mapping{
+		{Match: "^bin/"},
+		{Glob: "**/*.md"},
+		{Path: ".config/nvim"},
+	}
+
+	for _, m := range valid {
+		if err := m.Compile(); err != nil {
+			t.Fatalf("Compile(%s) returned error: %v", m, err)
+		}
+	}
+
+	invalid := []*Mapping{
+		{Match: "broken("},
+		{Glob: "[broken"},
+		{Path: "../outside"},
+		{Path: "."},
+		{Match: "foo", Glob: "foo"},
+	}
+
+	for _, m := range invalid {
+		if err := m.Compile(); err == nil {
+			t.Fatalf("expected Compile(%s) to return an error", m)
+		}
+	}
+}
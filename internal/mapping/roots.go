@@ -0,0 +1,117 @@
+package mapping
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// The named target roots files can be linked under.
+const (
+	RootHome      = "home"
+	RootXDGConfig = "xdg_config"
+	RootXDGData   = "xdg_data"
+	RootXDGState  = "xdg_state"
+)
+
+// xdgRoot is a target root which can be moved with an XDG environment
+// variable. dir is where it is relative to the home directory when the
+// variable isn't set, which is also where its files live in a profile.
+type xdgRoot struct {
+	name string
+	env  string
+	dir  string
+}
+
+var xdgRoots = []xdgRoot{
+	{name: RootXDGConfig, env: "XDG_CONFIG_HOME", dir: ".config"},
+	{name: RootXDGData, env: "XDG_DATA_HOME", dir: ".local/share"},
+	{name: RootXDGState, env: "XDG_STATE_HOME", dir: ".local/state"},
+}
+
+// Roots returns the names of every target root.
+func Roots() []string {
+	names := []string{RootHome}
+	for _, root := range xdgRoots {
+		names = append(names, root.name)
+	}
+
+	return names
+}
+
+// resolve returns the directory of the root. The XDG variables describe the
+// user's own home directory so any other home, such as a scratch directory
+// being linked into, gets the default.
+func (r xdgRoot) resolve(home string) string {
+	if dir := os.Getenv(r.env); dir != "" && isUserHome(home) {
+		return dir
+	}
+
+	return filepath.Join(home, filepath.FromSlash(r.dir))
+}
+
+// ResolveRoot returns the directory the named target root refers to for the
+// given home directory. Absolute paths, or paths starting with ~/, can be
+// used in place of a name to link somewhere other than the named roots.
+func ResolveRoot(name, home string) (string, error) {
+	if name == RootHome || name == "~" {
+		return home, nil
+	}
+
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		return filepath.Join(home, filepath.FromSlash(rest)), nil
+	}
+
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name), nil
+	}
+
+	for _, root := range xdgRoots {
+		if root.name == name {
+			return root.resolve(home), nil
+		}
+	}
+
+	return "", fmt.Errorf(
+		"unknown target root %q, must be an absolute path or one of %s",
+		name,
+		strings.Join(Roots(), ", "),
+	)
+}
+
+// ProfilePath returns where the file at path belongs in a profile, relative
+// to the dotfile directory, so that linking the profile puts it back at path.
+// Files in an XDG root go in the directory that root has under the home
+// directory by default, so $XDG_CONFIG_HOME/nvim becomes .config/nvim.
+func ProfilePath(path, home string) (string, error) {
+	best, bestRoot := "", ""
+	for _, root := range xdgRoots {
+		dir := root.resolve(home)
+		if utils.IsWithin(path, dir) && len(dir) > len(bestRoot) {
+			best, bestRoot = root.dir, dir
+		}
+	}
+
+	if bestRoot != "" {
+		rel, err := filepath.Rel(bestRoot, path)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(filepath.FromSlash(best), rel), nil
+	}
+
+	if !utils.IsWithin(path, home) {
+		return "", fmt.Errorf("%s is not in the home directory or an XDG directory", path)
+	}
+
+	return filepath.Rel(home, path)
+}
+
+func isUserHome(home string) bool {
+	userHome, err := os.UserHomeDir()
+	return err == nil && filepath.Clean(userHome) == filepath.Clean(home)
+}
@@ -0,0 +1,101 @@
+package mapping
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveRoot(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+
+	cases := map[string]string{
+		RootHome:      "/home/me",
+		RootXDGConfig: "/xdg/config",
+		RootXDGData:   "/home/me/.local/share",
+		RootXDGState:  "/home/me/.local/state",
+		"/etc/":       "/etc",
+		"~/work":      "/home/me/work",
+	}
+
+	for name, want := range cases {
+		got, err := ResolveRoot(name, "/home/me")
+		if err != nil {
+			t.Fatalf("ResolveRoot(%q) returned error: %v", name, err)
+		}
+
+		if got != want {
+			t.Fatalf("ResolveRoot(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := ResolveRoot("xdg_cache", "/home/me"); err == nil {
+		t.Fatal("expected an unknown root to return an error")
+	}
+
+	if _, err := ResolveRoot("relative/dir", "/home/me"); err == nil {
+		t.Fatal("expected a relative path to return an error")
+	}
+}
+
+func TestResolveRootIgnoresXDGForOtherHomes(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+
+	got, err := ResolveRoot(RootXDGConfig, "/scratch")
+	if err != nil {
+		t.Fatalf("ResolveRoot returned error: %v", err)
+	}
+
+	if got != "/scratch/.config" {
+		t.Fatalf("ResolveRoot(%q) = %q, want /scratch/.config", RootXDGConfig, got)
+	}
+}
+
+func TestProfilePathRoundTripsThroughDefaults(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_STATE_HOME", "")
+
+	cases := map[string]string{
+		"/xdg/config/nvim/init.lua":       ".config/nvim/init.lua",
+		"/xdg/data/fonts/mono.ttf":        ".local/share/fonts/mono.ttf",
+		"/home/me/.local/state/app/state": ".local/state/app/state",
+		"/home/me/.bashrc":                ".bashrc",
+	}
+
+	for path, want := range cases {
+		rel, err := ProfilePath(path, "/home/me")
+		if err != nil {
+			t.Fatalf("ProfilePath(%q) returned error: %v", path, err)
+		}
+
+		if filepath.ToSlash(rel) != want {
+			t.Fatalf("ProfilePath(%q) = %q, want %q", path, rel, want)
+		}
+
+		// Linking the profile path with the defaults must lead back to
+		// where the file came from.
+		target := filepath.Join("/home/me", rel)
+		for _, m := range Defaults() {
+			if m.IsMatch(filepath.Join("/profile", rel), filepath.ToSlash(rel)) {
+				if translated, ok := m.Translate(rel, "/home/me"); ok {
+					target = translated
+				}
+
+				break
+			}
+		}
+
+		if target != path {
+			t.Fatalf("linking %q leads to %q, want %q", rel, target, path)
+		}
+	}
+
+	if _, err := ProfilePath("/etc/hosts", "/home/me"); err == nil {
+		t.Fatal("expected a path outside of home and the XDG directories to return an error")
+	}
+}
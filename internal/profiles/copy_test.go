@@ -0,0 +1,210 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+
+	return string(content)
+}
+
+func TestLinkCopyStrategyTracksChanges(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	source := filepath.Join(repo, ".apprc")
+	target := filepath.Join(home, ".apprc")
+
+	if err := os.WriteFile(source, []byte("v1"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo, LinkStrategy: mapping.StrategyCopy})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatalf("expected copy to exist: %v", err)
+	}
+
+	if !info.Mode().IsRegular() || readFile(t, target) != "v1" {
+		t.Fatalf("expected a regular file copy, got mode %v", info.Mode())
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	entry, ok := m.Get(target)
+	if !ok || entry.Strategy != mapping.StrategyCopy || entry.Checksum == "" || !entry.Owns() {
+		t.Fatalf("unexpected manifest entry: %+v", entry)
+	}
+
+	// A change in the profile updates the untouched copy.
+	if err := os.WriteFile(source, []byte("v2"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	plan, err := profile.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".apprc"]; kind != LinkUpdateCopy {
+		t.Fatalf("expected update_copy, got %s", kind)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if got := readFile(t, target); got != "v2" {
+		t.Fatalf("copy content = %q, want v2", got)
+	}
+
+	// A change in the home directory is refused until it is adopted.
+	if err := os.WriteFile(target, []byte("edited"), 0644); err != nil {
+		t.Fatalf("failed to edit copy: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err == nil {
+		t.Fatal("expected Link to refuse to overwrite a modified copy")
+	}
+
+	if got := readFile(t, target); got != "edited" {
+		t.Fatalf("modified copy was overwritten with %q", got)
+	}
+
+	if err := profile.Link(LinkOptions{Adopt: true}); err != nil {
+		t.Fatalf("Link with Adopt returned error: %v", err)
+	}
+
+	if got := readFile(t, source); got != "edited" {
+		t.Fatalf("source content = %q, want the adopted change", got)
+	}
+
+	plan, err = profile.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".apprc"]; kind != LinkSkip {
+		t.Fatalf("expected skip after adopting, got %s", kind)
+	}
+}
+
+func TestMappingOverridesLinkStrategy(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{".linked", ".copied"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Mappings: []*mapping.Mapping{
+			{Match: `\.copied$`, LinkStrategy: mapping.StrategyCopy},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if info, err := os.Lstat(filepath.Join(home, ".linked")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected .linked to be a symlink, got %v, %v", info, err)
+	}
+
+	if info, err := os.Lstat(filepath.Join(home, ".copied")); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("expected .copied to be a regular file, got %v, %v", info, err)
+	}
+}
+
+func TestLinkRollsBackUpdatedCopy(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	source := filepath.Join(repo, ".apprc")
+	target := filepath.Join(home, ".apprc")
+
+	if err := os.WriteFile(source, []byte("v1"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo, LinkStrategy: mapping.StrategyCopy})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if err := os.WriteFile(source, []byte("v2"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	run, err := newLinkRun(profile, LinkOptions{})
+	if err != nil {
+		t.Fatalf("newLinkRun returned error: %v", err)
+	}
+
+	actions, err := profile.planOwn(run)
+	if err != nil {
+		t.Fatalf("planOwn returned error: %v", err)
+	}
+
+	for _, action := range actions {
+		if err := run.apply(profile, action); err != nil {
+			t.Fatalf("apply returned error: %v", err)
+		}
+	}
+
+	if got := readFile(t, target); got != "v2" {
+		t.Fatalf("copy content = %q, want v2", got)
+	}
+
+	if err := run.rollback(); err != nil {
+		t.Fatalf("rollback returned error: %v", err)
+	}
+
+	if got := readFile(t, target); got != "v1" {
+		t.Fatalf("copy content after rollback = %q, want v1", got)
+	}
+}
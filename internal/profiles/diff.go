@@ -0,0 +1,143 @@
+package profiles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns a unified diff turning oldText into newText, or "" if
+// they are the same.
+func unifiedDiff(oldName, oldText, newName, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	// Group the changes into hunks, merging those whose context overlaps.
+	type hunk struct{ start, end int }
+	hunks := []hunk{}
+	for idx, line := range lines {
+		if line.op == ' ' {
+			continue
+		}
+
+		start, end := max(0, idx-diffContext), min(len(lines), idx+diffContext+1)
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	oldLine, newLine, pos := 1, 1, 0
+	advance := func(line diffLine) {
+		if line.op != '+' {
+			oldLine++
+		}
+
+		if line.op != '-' {
+			newLine++
+		}
+	}
+
+	for _, h := range hunks {
+		for ; pos < h.start; pos++ {
+			advance(lines[pos])
+		}
+
+		oldStart, newStart := oldLine, newLine
+		oldCount, newCount := 0, 0
+		for _, line := range lines[h.start:h.end] {
+			if line.op != '+' {
+				oldCount++
+			}
+
+			if line.op != '-' {
+				newCount++
+			}
+		}
+
+		// An empty side is numbered by the line before it.
+		if oldCount == 0 {
+			oldStart--
+		}
+
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for ; pos < h.end; pos++ {
+			fmt.Fprintf(&out, "%c%s\n", lines[pos].op, lines[pos].text)
+			advance(lines[pos])
+		}
+	}
+
+	return out.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line based edit script from a to b using the longest
+// common subsequence.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
@@ -0,0 +1,362 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// ErrNotLinked is returned by Explain for paths which are neither in the
+// profile nor linked by it.
+var ErrNotLinked = errors.New("not in the profile or linked")
+
+// ExplainStep is a single decision made while planning a path.
+type ExplainStep struct {
+	Path string `json:"path"`
+	// Mapping names the mapping which was evaluated, such as mappings[0],
+	// it is empty for steps which didn't involve a mapping.
+	Mapping string `json:"mapping,omitempty"`
+	// Definition is a short description of the mapping, see
+	// mapping.Mapping.Describe.
+	Definition string `json:"definition,omitempty"`
+	Matched    bool   `json:"matched"`
+	// Action is the mapping.Action of a matching mapping.
+	Action string `json:"action,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// trace records the decisions made while planning paths for Explain, a nil
+// trace records nothing.
+type trace struct {
+	steps []ExplainStep
+}
+
+func (t *trace) note(path, reason string) {
+	if t == nil {
+		return
+	}
+
+	t.steps = append(t.steps, ExplainStep{Path: path, Reason: reason})
+}
+
+func (t *trace) mapping(path, name string, m *mapping.Mapping, matched bool, reason string) {
+	if t == nil {
+		return
+	}
+
+	step := ExplainStep{
+		Path:       path,
+		Mapping:    name,
+		Definition: m.Describe(),
+		Matched:    matched,
+		Reason:     reason,
+	}
+
+	if matched {
+		step.Action = m.Action().String()
+	}
+
+	t.steps = append(t.steps, step)
+}
+
+// Explanation describes how linking treats a single path.
+type Explanation struct {
+	// Path is the path which was explained, either a file in a profile or
+	// a link target.
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// Profile is the location of the profile or module the source is in.
+	Profile string `json:"profile"`
+	// TargetRoot is the directory the source is linked relative to.
+	TargetRoot string `json:"target_root,omitempty"`
+	// Steps are the decisions made for the source and each directory
+	// above it, in the order linking makes them.
+	Steps []ExplainStep `json:"steps"`
+	// Action is what linking does for the source, it is the action of the
+	// directory the source is in when that is linked as a whole.
+	Action      *LinkAction `json:"action,omitempty"`
+	Destination string      `json:"destination,omitempty"`
+	Reason      string      `json:"reason"`
+}
+
+// WriteText writes a human readable form of the explanation to w.
+func (e *Explanation) WriteText(w io.Writer) error {
+	lines := []string{
+		fmt.Sprintf("path:        %s", e.Path),
+		fmt.Sprintf("source:      %s", e.Source),
+		fmt.Sprintf("profile:     %s", e.Profile),
+	}
+
+	if e.TargetRoot != "" {
+		lines = append(lines, fmt.Sprintf("target root: %s", e.TargetRoot))
+	}
+
+	lines = append(lines, "")
+	current := ""
+	for _, step := range e.Steps {
+		if step.Path != current {
+			current = step.Path
+			lines = append(lines, current)
+		}
+
+		switch {
+		case step.Mapping == "":
+			lines = append(lines, fmt.Sprintf("  %s", step.Reason))
+		case step.Matched:
+			lines = append(lines, fmt.Sprintf("  %s (%s): matched, %s", step.Mapping, step.Definition, step.Action))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s (%s): %s", step.Mapping, step.Definition, step.Reason))
+		}
+	}
+
+	if len(e.Steps) > 0 {
+		lines = append(lines, "")
+	}
+
+	if e.Action != nil {
+		kind := e.Action.Kind.String()
+		if e.Action.Reason != "" && e.Action.Reason != e.Reason {
+			kind = fmt.Sprintf("%s (%s)", kind, e.Action.Reason)
+		}
+
+		lines = append(lines, fmt.Sprintf("action:      %s", kind))
+	}
+
+	if e.Destination != "" {
+		lines = append(lines, fmt.Sprintf("destination: %s", e.Destination))
+	}
+
+	lines = append(lines, fmt.Sprintf("reason:      %s", e.Reason))
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Explain describes how linking the profile treats path, which may be a file
+// in the profile or one of its modules or the target of a link.
+func (p *Profile) Explain(path string, opts LinkOptions) (*Explanation, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := newLinkRun(p, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{Path: abs, Source: abs, Steps: []ExplainStep{}}
+
+	owner, root, err := p.findSource(run, abs)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner == nil {
+		source, err := p.sourceForTarget(run, opts, abs)
+		if err != nil {
+			return nil, err
+		}
+
+		explanation.Source = source
+		owner, root, err = p.findSource(run, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if owner == nil {
+		return nil, fmt.Errorf("%w: %s by %s", ErrNotLinked, abs, p.config.Location)
+	}
+
+	explanation.Profile = owner.config.Location
+	if root == nil {
+		explanation.Reason = "not in any of the target directories of the profile so it is not linked"
+		return explanation, nil
+	}
+
+	explanation.TargetRoot = root.target
+	return explanation, owner.explain(run, *root, explanation)
+}
+
+// explain fills in how linking treats explanation.Source, which is in root,
+// by planning each directory above it and then the source itself the same
+// way walking root does.
+func (p *Profile) explain(run *linkRun, root linkRoot, explanation *Explanation) error {
+	tr := &trace{}
+	defer func() { explanation.Steps = tr.steps }()
+
+	source := explanation.Source
+	dirs := []string{}
+	for dir := filepath.Dir(source); source != root.dir && utils.IsWithin(dir, root.dir); dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == root.dir {
+			break
+		}
+	}
+
+	for _, dir := range dirs {
+		entry, err := dirEntry(dir)
+		if err != nil {
+			return err
+		}
+
+		action, planned, err := p.planPath(run, root, dir, entry, tr)
+		if err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// Only link_as_dir mappings plan an action with a target for a
+		// directory.
+		if planned && action.Target != "" {
+			rel, err := filepath.Rel(dir, source)
+			if err != nil {
+				return err
+			}
+
+			explanation.Action = &action
+			explanation.Destination = filepath.Join(action.Target, rel)
+			explanation.Reason = fmt.Sprintf("%s is linked as a directory so its contents are linked with it", dir)
+			return nil
+		}
+
+		explanation.Reason = fmt.Sprintf("%s is skipped so nothing inside it is linked", dir)
+		if planned {
+			explanation.Action = &action
+		}
+
+		return nil
+	}
+
+	entry, err := dirEntry(source)
+	if err != nil {
+		return err
+	}
+
+	action, planned, err := p.planPath(run, root, source, entry, tr)
+	if err != nil && !errors.Is(err, filepath.SkipDir) {
+		return err
+	}
+
+	switch {
+	case planned:
+		explanation.Action = &action
+		explanation.Reason = action.Reason
+		if action.Kind != LinkSkip {
+			explanation.Destination = action.Target
+		}
+
+		if explanation.Reason == "" {
+			explanation.Reason = fmt.Sprintf("planned to %s", action.Kind)
+		}
+	case entry.IsDir():
+		explanation.Reason = "directories are not linked themselves, the files inside them are"
+	default:
+		explanation.Reason = "not linked"
+		if len(tr.steps) > 0 {
+			explanation.Reason = tr.steps[len(tr.steps)-1].Reason
+		}
+	}
+
+	return nil
+}
+
+func dirEntry(path string) (fs.DirEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.FileInfoToDirEntry(info), nil
+}
+
+// all returns the profile and all of its modules, recursively.
+func (p *Profile) all() []*Profile {
+	profiles := []*Profile{p}
+	for _, module := range p.modules {
+		profiles = append(profiles, module.all()...)
+	}
+
+	return profiles
+}
+
+// findSource returns the profile or module whose files include path and the
+// link root of it path is in. The root is nil when path is in the profile
+// but outside of all of its targets, both are nil when no profile includes
+// path.
+func (p *Profile) findSource(run *linkRun, path string) (*Profile, *linkRoot, error) {
+	var owner *Profile
+	var best *linkRoot
+	for _, candidate := range p.all() {
+		roots, err := candidate.linkRoots(run.home)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for idx, root := range roots {
+			if utils.IsWithin(path, root.dir) && (best == nil || len(root.dir) > len(best.dir)) {
+				owner, best = candidate, &roots[idx]
+			}
+		}
+	}
+
+	if owner != nil {
+		return owner, best, nil
+	}
+
+	for _, candidate := range p.all() {
+		if utils.IsWithin(path, candidate.config.GetDotfileDirectory()) {
+			return candidate, nil, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// sourceForTarget returns the source linked to target, or to the directory
+// containing it, by the profile. Targets recorded in the manifest for the
+// profile are found even if the profile no longer links them.
+func (p *Profile) sourceForTarget(run *linkRun, opts LinkOptions, target string) (string, error) {
+	plan, err := p.Plan(opts)
+	if err != nil {
+		return "", err
+	}
+
+	for _, action := range plan.Actions {
+		if action.Kind == LinkRemove || action.Target == "" {
+			continue
+		}
+
+		if !utils.IsWithin(target, action.Target) {
+			continue
+		}
+
+		rel, err := filepath.Rel(action.Target, target)
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(action.Source, rel), nil
+	}
+
+	if entry, ok := run.manifest.Get(target); ok && entry.Profile == p.config.Location {
+		return entry.Source, nil
+	}
+
+	return target, nil
+}
@@ -0,0 +1,140 @@
+package profiles
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func newExplainProfile(t *testing.T) (*Profile, string, string) {
+	t.Helper()
+
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{".bashrc", ".vim/colors/dark.vim", "windows.ini", "README.md"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Mappings: []*mapping.Mapping{
+			{Path: ".vim", LinkAsDir: true},
+			{Path: "windows.ini", TargetOS: "plan9", Dest: "~/windows.ini"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	return profile, repo, home
+}
+
+func TestExplainSourcePath(t *testing.T) {
+	profile, repo, home := newExplainProfile(t)
+
+	explanation, err := profile.Explain(filepath.Join(repo, "windows.ini"), LinkOptions{})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+
+	if explanation.Profile != repo {
+		t.Fatalf("expected profile %s, got %s", repo, explanation.Profile)
+	}
+
+	if explanation.Action == nil || explanation.Action.Kind != LinkCreate {
+		t.Fatalf("expected a create action, got %+v", explanation.Action)
+	}
+
+	if want := filepath.Join(home, "windows.ini"); explanation.Destination != want {
+		t.Fatalf("expected destination %s, got %s", want, explanation.Destination)
+	}
+
+	var step *ExplainStep
+	for idx := range explanation.Steps {
+		if explanation.Steps[idx].Mapping == "mappings[1]" {
+			step = &explanation.Steps[idx]
+		}
+	}
+
+	if step == nil || step.Matched || !strings.Contains(step.Reason, "target_os") {
+		t.Fatalf("expected mappings[1] to not match because of target_os, got %+v", explanation.Steps)
+	}
+}
+
+func TestExplainLinkAsDirParent(t *testing.T) {
+	profile, repo, home := newExplainProfile(t)
+
+	explanation, err := profile.Explain(filepath.Join(repo, ".vim", "colors", "dark.vim"), LinkOptions{})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+
+	if want := filepath.Join(home, ".vim", "colors", "dark.vim"); explanation.Destination != want {
+		t.Fatalf("expected destination %s, got %s", want, explanation.Destination)
+	}
+
+	if !strings.Contains(explanation.Reason, "linked as a directory") {
+		t.Fatalf("expected the link_as_dir parent to be explained, got %q", explanation.Reason)
+	}
+
+	last := explanation.Steps[len(explanation.Steps)-1]
+	if last.Path != filepath.Join(repo, ".vim") || !last.Matched || last.Action != "LINK_AS_DIR" {
+		t.Fatalf("expected the last step to be the .vim mapping, got %+v", last)
+	}
+}
+
+func TestExplainTargetPath(t *testing.T) {
+	profile, repo, home := newExplainProfile(t)
+
+	explanation, err := profile.Explain(filepath.Join(home, ".vim", "colors", "dark.vim"), LinkOptions{})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+
+	if want := filepath.Join(repo, ".vim", "colors", "dark.vim"); explanation.Source != want {
+		t.Fatalf("expected source %s, got %s", want, explanation.Source)
+	}
+
+	explanation, err = profile.Explain(filepath.Join(home, ".bashrc"), LinkOptions{})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+
+	if want := filepath.Join(repo, ".bashrc"); explanation.Source != want {
+		t.Fatalf("expected source %s, got %s", want, explanation.Source)
+	}
+
+	if _, err := profile.Explain(filepath.Join(home, ".zshrc"), LinkOptions{}); !errors.Is(err, ErrNotLinked) {
+		t.Fatalf("expected ErrNotLinked, got %v", err)
+	}
+}
+
+func TestExplainSkippedPath(t *testing.T) {
+	profile, repo, _ := newExplainProfile(t)
+
+	explanation, err := profile.Explain(filepath.Join(repo, "README.md"), LinkOptions{})
+	if err != nil {
+		t.Fatalf("Explain returned error: %v", err)
+	}
+
+	if explanation.Action == nil || explanation.Action.Kind != LinkSkip || explanation.Destination != "" {
+		t.Fatalf("expected README.md to be skipped, got %+v", explanation)
+	}
+}
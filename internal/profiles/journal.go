@@ -0,0 +1,170 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chasinglogic/dfm/internal/backup"
+	"github.com/chasinglogic/dfm/internal/logger"
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// change is a filesystem change made by a link run which can be undone.
+type change interface {
+	undo() error
+}
+
+// removedLink is a stale link removed when switching profiles, it keeps what
+// is needed to create the link again exactly as it was.
+type removedLink struct {
+	target   string
+	source   string
+	strategy string
+
+	// linkText is what a removed symlink held, content and perm are what a
+	// removed copy held.
+	linkText string
+	content  []byte
+	perm     os.FileMode
+}
+
+func newRemovedLink(entry manifest.Entry) (removedLink, error) {
+	rl := removedLink{target: entry.Target, source: entry.Source, strategy: entry.Strategy}
+
+	info, err := os.Lstat(entry.Target)
+	if os.IsNotExist(err) {
+		return rl, nil
+	} else if err != nil {
+		return rl, err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		rl.linkText, err = os.Readlink(entry.Target)
+	case entry.Strategy == mapping.StrategyCopy:
+		rl.perm = info.Mode().Perm()
+		rl.content, err = os.ReadFile(entry.Target)
+	}
+
+	return rl, err
+}
+
+func (rl removedLink) undo() error {
+	if _, err := os.Lstat(rl.target); err == nil {
+		return fmt.Errorf("cannot restore link %s because something else was created there", rl.target)
+	}
+
+	switch {
+	case rl.content != nil:
+		return utils.WriteFileAtomic(rl.target, rl.content, rl.perm)
+	case rl.strategy == mapping.StrategyHardlink:
+		return os.Link(rl.source, rl.target)
+	case rl.linkText != "":
+		return os.Symlink(rl.linkText, rl.target)
+	}
+
+	// Nothing was there to remove.
+	return nil
+}
+
+// adoptedCopy is a profile file overwritten with the changes made to its copy
+// in the home directory.
+type adoptedCopy struct {
+	source   string
+	previous []byte
+	perm     os.FileMode
+}
+
+func (ac adoptedCopy) undo() error {
+	return utils.WriteFileAtomic(ac.source, ac.previous, ac.perm)
+}
+
+// rollback undoes every change in the journal in reverse order so that the
+// target directory is left as it was before the run started.
+func (r *linkRun) rollback() error {
+	errs := []error{}
+	for idx := len(r.journal) - 1; idx >= 0; idx-- {
+		if err := r.journal[idx].undo(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	r.journal = nil
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to roll back link: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// rollbackRuns rolls back each of runs, the last one first.
+func rollbackRuns(runs []*linkRun) error {
+	errs := []error{}
+	for idx := len(runs) - 1; idx >= 0; idx-- {
+		errs = append(errs, runs[idx].rollback())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (lr linkResult) undo() error {
+	logger.Debug().
+		Str("target", lr.target).
+		Str("backup", lr.backup).
+		Str("replacedLink", lr.replacedLink).
+		Msg("undoing link")
+
+	if lr.linked {
+		// Only remove the link if it is still the one this run made.
+		existing, err := os.Readlink(lr.target)
+		if err == nil && existing == lr.linkText {
+			if err := os.Remove(lr.target); err != nil {
+				return err
+			}
+		}
+	}
+
+	if lr.hardlinked && utils.SameFile(lr.target, lr.source) {
+		if err := os.Remove(lr.target); err != nil {
+			return err
+		}
+	}
+
+	if lr.copied {
+		// Only touch the copy if it is still the one this run wrote.
+		checksum, err := utils.Checksum(lr.target)
+		if err == nil && checksum == lr.checksum {
+			if lr.previous != nil {
+				return utils.WriteFileAtomic(lr.target, lr.previous, lr.previousPerm)
+			}
+
+			if err := os.Remove(lr.target); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dir := range lr.createdDirs {
+		if err := removeIfEmpty(dir); err != nil {
+			return err
+		}
+	}
+
+	if lr.replacedLink != "" {
+		if err := os.Symlink(lr.replacedLink, lr.target); err != nil {
+			return err
+		}
+	}
+
+	if lr.backup != "" {
+		if _, err := backup.Restore(lr.backup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/hooks"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+func setupFailingLink(t *testing.T) (string, string, *Profile) {
+	t.Helper()
+
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(repo, ".config", "tool"), 0755); err != nil {
+		t.Fatalf("failed to create source dirs: %v", err)
+	}
+
+	for _, name := range []string{".bashrc", ".vimrc", filepath.Join(".config", "tool", "config")} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("profile"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := os.Symlink("/previous/vimrc", filepath.Join(home, ".vimrc")); err != nil {
+		t.Fatalf("failed to create existing link: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{
+		Location: repo,
+		Hooks:    hooks.Hooks{"post_link": []any{"false"}},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	return home, repo, p
+}
+
+func TestLinkRollsBackOnFailure(t *testing.T) {
+	home, repo, p := setupFailingLink(t)
+
+	if err := p.Link(LinkOptions{Overwrite: true}); err == nil {
+		t.Fatal("expected Link to fail because of the post_link hook")
+	}
+
+	content, err := os.ReadFile(filepath.Join(home, ".bashrc"))
+	if err != nil {
+		t.Fatalf("expected .bashrc to be restored: %v", err)
+	}
+
+	if string(content) != "original" {
+		t.Fatalf(".bashrc content = %q, want %q", content, "original")
+	}
+
+	link, err := os.Readlink(filepath.Join(home, ".vimrc"))
+	if err != nil || link != "/previous/vimrc" {
+		t.Fatalf("expected .vimrc link to be restored, got %q err=%v", link, err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".config")); !os.IsNotExist(err) {
+		t.Fatalf("expected created directories to be removed, got err=%v", err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if entries := m.ForProfile(repo); len(entries) != 0 {
+		t.Fatalf("expected nothing to be recorded, got %+v", entries)
+	}
+}
+
+func TestLinkWithoutRollbackLeavesChanges(t *testing.T) {
+	home, repo, p := setupFailingLink(t)
+
+	if err := p.Link(LinkOptions{Overwrite: true, NoRollback: true}); err == nil {
+		t.Fatal("expected Link to fail because of the post_link hook")
+	}
+
+	link, err := os.Readlink(filepath.Join(home, ".bashrc"))
+	if err != nil || link != filepath.Join(repo, ".bashrc") {
+		t.Fatalf("expected .bashrc link to remain, got %q err=%v", link, err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if entries := m.ForProfile(repo); len(entries) != 3 {
+		t.Fatalf("expected the links made to be recorded, got %+v", entries)
+	}
+}
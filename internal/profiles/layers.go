@@ -0,0 +1,110 @@
+package profiles
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/chasinglogic/dfm/internal/logger"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+// LinkLayers links each of layers, ordered from the bottom layer to the top,
+// as Link does. If linking any of them fails the changes made for all of them
+// are undone unless opts.NoRollback is set.
+func LinkLayers(layers []*Profile, opts LinkOptions) error {
+	// The layers being linked aren't being switched away from, their links
+	// would otherwise be removed as stale by the runs for the other layers.
+	opts.SwitchFrom = slices.DeleteFunc(slices.Clone(opts.SwitchFrom), func(location string) bool {
+		return slices.ContainsFunc(layers, func(p *Profile) bool {
+			return p.GetLocation() == location
+		})
+	})
+
+	runs := make([]*linkRun, 0, len(layers))
+	var m *manifest.Manifest
+	for _, p := range layers {
+		run, err := newLinkRun(p, opts)
+		if err != nil {
+			return errors.Join(err, rollbackRuns(runs))
+		}
+
+		// The layers share a manifest so that it is only saved once they
+		// have all been linked.
+		if m == nil {
+			m = run.manifest
+		}
+
+		run.manifest = m
+		runs = append(runs, run)
+
+		err = p.link(run)
+		if err == nil {
+			err = run.removeStaleLinks(p, opts.SwitchFrom)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if !opts.NoRollback {
+			logger.Debug().Err(err).Int("layers", len(runs)).Msg("link failed, rolling back")
+			return errors.Join(err, rollbackRuns(runs))
+		}
+
+		// Without a rollback the manifest is still saved so that it
+		// describes every link which was made.
+		return errors.Join(err, m.Save())
+	}
+
+	if m == nil {
+		return nil
+	}
+
+	if err := m.Save(); err != nil {
+		return err
+	}
+
+	for idx, run := range runs {
+		if _, err := restoreUnlinked(run.unlinked); err != nil {
+			return err
+		}
+
+		if err := layers[idx].pruneBackups(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RelinkTargets links the files of layers, the active profiles from the bottom
+// layer to the top, which they link to any of targets in home. Unlinking a
+// profile uses it before removing the profile's links, so that the targets
+// the profile took over are handed back to the layers under it. Their links
+// replace the profile's and keep whatever was backed up when the target was
+// first linked, it is only restored once no layer links the target.
+func RelinkTargets(layers []*Profile, home string, targets []string) error {
+	opts := LinkOptions{Home: home}
+	paths := []string{}
+	for _, layer := range layers {
+		plan, err := layer.Plan(opts)
+		if err != nil {
+			return err
+		}
+
+		for _, action := range plan.Actions {
+			if action.Kind == LinkRemove || action.Kind.Refused() || !slices.Contains(targets, action.Target) {
+				continue
+			}
+
+			paths = append(paths, action.Source)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	opts.Paths = paths
+	return LinkLayers(layers, opts)
+}
@@ -0,0 +1,182 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+// newLayers writes each layer's files to a new directory and returns the
+// profiles for them, from the bottom layer to the top.
+func newLayers(t *testing.T, layerFiles ...map[string]string) []*Profile {
+	t.Helper()
+
+	layers := []*Profile{}
+	for _, files := range layerFiles {
+		repo := t.TempDir()
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", name, err)
+			}
+		}
+
+		profile, err := New(&config.Config{Location: repo})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+
+		layers = append(layers, profile)
+	}
+
+	return layers
+}
+
+func TestLinkLayersRollsBackEveryLayer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	layers := newLayers(t,
+		map[string]string{".base": "base", ".shared": "base"},
+		map[string]string{".shared": "work", ".conflict": "work"},
+	)
+
+	if err := os.WriteFile(filepath.Join(home, ".conflict"), []byte("mine"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := LinkLayers(layers, LinkOptions{}); err == nil {
+		t.Fatalf("expected linking over an existing file to fail")
+	}
+
+	for _, name := range []string{".base", ".shared"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be rolled back, got %v", name, err)
+		}
+	}
+
+	if got := readFile(t, filepath.Join(home, ".conflict")); got != "mine" {
+		t.Fatalf("expected the existing file to be left alone, got %q", got)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if entries := m.Entries(); len(entries) != 0 {
+		t.Fatalf("expected nothing to be recorded, got %+v", entries)
+	}
+
+	if err := LinkLayers(layers, LinkOptions{NoRollback: true}); err == nil {
+		t.Fatalf("expected linking over an existing file to fail")
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".base")); err != nil {
+		t.Fatalf("expected the bottom layer to stay linked without a rollback, got %v", err)
+	}
+}
+
+func TestRelinkTargetsBeforeUnlinkingTopLayer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	layers := newLayers(t,
+		map[string]string{".base": "base", ".shared": "base"},
+		map[string]string{".shared": "work", ".work": "work"},
+	)
+
+	shared := filepath.Join(home, ".shared")
+	if err := os.WriteFile(shared, []byte("mine"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := LinkLayers(layers[:1], LinkOptions{Overwrite: true}); err != nil {
+		t.Fatalf("LinkLayers returned error: %v", err)
+	}
+
+	if err := LinkLayers(layers, LinkOptions{}); err != nil {
+		t.Fatalf("LinkLayers returned error: %v", err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	targets := []string{}
+	for _, entry := range m.ForProfile(layers[1].GetLocation()) {
+		targets = append(targets, entry.Target)
+	}
+
+	if err := RelinkTargets(layers[:1], "", targets); err != nil {
+		t.Fatalf("RelinkTargets returned error: %v", err)
+	}
+
+	m, err = manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if _, err := Unlink(m, layers[1].GetLocation()); err != nil {
+		t.Fatalf("Unlink returned error: %v", err)
+	}
+
+	if got := readFile(t, shared); got != "base" {
+		t.Fatalf("expected .shared to be handed back to the bottom layer, got %q", got)
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".work")); !os.IsNotExist(err) {
+		t.Fatalf("expected .work to be unlinked, got %v", err)
+	}
+
+	entry, ok := m.Get(shared)
+	if !ok || entry.Profile != layers[0].GetLocation() || entry.Backup == "" {
+		t.Fatalf("expected .shared to be recorded for the bottom layer with its backup, got %+v", entry)
+	}
+
+	if _, err := Unlink(m, layers[0].GetLocation()); err != nil {
+		t.Fatalf("Unlink returned error: %v", err)
+	}
+
+	if got := readFile(t, shared); got != "mine" {
+		t.Fatalf("expected the original file to be restored once no layer links it, got %q", got)
+	}
+}
+
+func TestLinkLayersSwitchKeepsEveryLayer(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	layers := newLayers(t,
+		map[string]string{".base": "base"},
+		map[string]string{".work": "work"},
+	)
+
+	if err := os.WriteFile(filepath.Join(home, ".work"), []byte("mine"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := LinkLayers(layers, LinkOptions{Overwrite: true}); err != nil {
+		t.Fatalf("LinkLayers returned error: %v", err)
+	}
+
+	switchFrom := []string{layers[0].GetLocation(), layers[1].GetLocation()}
+	if err := LinkLayers(layers, LinkOptions{SwitchFrom: switchFrom}); err != nil {
+		t.Fatalf("relinking the stack with SwitchFrom returned error: %v", err)
+	}
+
+	for name, want := range map[string]string{".base": "base", ".work": "work"} {
+		if got := readFile(t, filepath.Join(home, name)); got != want {
+			t.Fatalf("expected %s to stay linked, got %q", name, got)
+		}
+	}
+}
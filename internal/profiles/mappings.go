@@ -0,0 +1,86 @@
+package profiles
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// MappingResult is whether one of a profile's mappings applies to a path.
+type MappingResult struct {
+	Index   int
+	Mapping *mapping.Mapping
+	Matched bool
+	// Reason is why the mapping doesn't apply, it is empty when it does.
+	Reason string
+}
+
+// CheckMappings checks each of the mappings of cfg, in order, against path
+// which is a file or directory in its dotfile directory. Linking uses the
+// first mapping which matches.
+func CheckMappings(cfg *config.Config, path string) ([]MappingResult, error) {
+	dir := cfg.GetDotfileDirectory()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	if !utils.IsWithin(path, dir) {
+		return nil, fmt.Errorf("%s is not in %s", path, dir)
+	}
+
+	rel, err := relativePath(linkRoot{dir: dir}, path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MappingResult, len(cfg.Mappings))
+	for idx, m := range cfg.Mappings {
+		matched, reason := m.Check(path, rel)
+		results[idx] = MappingResult{Index: idx, Mapping: m, Matched: matched, Reason: reason}
+	}
+
+	return results, nil
+}
+
+// MatchingPaths returns the files and directories in the dotfile directory of
+// cfg which m matches. Nothing inside a matching directory is included since
+// the directory includes it.
+func MatchingPaths(cfg *config.Config, m *mapping.Mapping) ([]string, error) {
+	if err := m.Compile(); err != nil {
+		return nil, err
+	}
+
+	root := linkRoot{dir: cfg.GetDotfileDirectory()}
+	paths := []string{}
+	err := filepath.WalkDir(root.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := relativePath(root, path)
+		if err != nil {
+			return err
+		}
+
+		if !m.IsMatch(path, rel) {
+			return nil
+		}
+
+		paths = append(paths, path)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	return paths, err
+}
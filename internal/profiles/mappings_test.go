@@ -0,0 +1,131 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func TestMatchingPaths(t *testing.T) {
+	repo := t.TempDir()
+	for _, name := range []string{"notes.md", ".vim/colors/dark.md", ".git/README.md", ".bashrc"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	cfg := &config.Config{Location: repo}
+	cases := []struct {
+		mapping *mapping.Mapping
+		want    []string
+	}{
+		{&mapping.Mapping{Glob: "**/*.md", Skip: true}, []string{".vim/colors/dark.md", "notes.md"}},
+		{&mapping.Mapping{Match: `\.vim`, LinkAsDir: true}, []string{".vim"}},
+		{&mapping.Mapping{Path: ".zshrc", Skip: true}, []string{}},
+	}
+
+	for _, tc := range cases {
+		got, err := MatchingPaths(cfg, tc.mapping)
+		if err != nil {
+			t.Fatalf("MatchingPaths(%s) returned error: %v", tc.mapping.Describe(), err)
+		}
+
+		want := make([]string, len(tc.want))
+		for idx, name := range tc.want {
+			want[idx] = filepath.Join(repo, name)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("MatchingPaths(%s) = %v, want %v", tc.mapping.Describe(), got, want)
+		}
+	}
+}
+
+func TestCheckMappings(t *testing.T) {
+	cfg := &config.Config{
+		Location: "/tmp/profile",
+		Mappings: []*mapping.Mapping{
+			{Glob: "**/*.md", Skip: true},
+			{Path: "docs/guide.md", Dest: "~/guide.md"},
+		},
+	}
+
+	results, err := CheckMappings(cfg, "docs/guide.md")
+	if err != nil {
+		t.Fatalf("CheckMappings returned error: %v", err)
+	}
+
+	if len(results) != 2 || !results[0].Matched || !results[1].Matched {
+		t.Fatalf("expected both mappings to match, got %+v", results)
+	}
+
+	results, err = CheckMappings(cfg, "/tmp/profile/.bashrc")
+	if err != nil {
+		t.Fatalf("CheckMappings returned error: %v", err)
+	}
+
+	if results[0].Matched || results[0].Reason == "" {
+		t.Fatalf("expected the glob not to match with a reason, got %+v", results[0])
+	}
+
+	if _, err := CheckMappings(cfg, "/etc/passwd"); err == nil {
+		t.Fatal("expected a path outside the profile to be rejected")
+	}
+}
+
+func TestLinkLimitedToPaths(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{".bashrc", "notes.md"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	cfg := &config.Config{Location: repo}
+	profile, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	// Skipping notes.md and linking only the paths the mapping matches
+	// removes its link and leaves everything else alone.
+	if err := os.Remove(filepath.Join(home, ".bashrc")); err != nil {
+		t.Fatalf("failed to remove .bashrc link: %v", err)
+	}
+
+	m := &mapping.Mapping{Glob: "*.md", Skip: true}
+	cfg.Mappings = append(cfg.Mappings, m)
+	paths, err := MatchingPaths(cfg, m)
+	if err != nil {
+		t.Fatalf("MatchingPaths returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{Paths: paths}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	for _, name := range []string{".bashrc", "notes.md"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be linked, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,794 @@
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
+)
+
+// LinkActionKind describes what applying a LinkAction will do to its target.
+type LinkActionKind int
+
+const (
+	LinkCreate LinkActionKind = iota
+	LinkReplaceSymlink
+	LinkReplaceFile
+	LinkReplaceDir
+	LinkSkip
+	LinkConflict
+	LinkSelfReferential
+	LinkRemove
+	LinkUpdateCopy
+	LinkAdopt
+	LinkModified
+)
+
+func (k LinkActionKind) String() string {
+	switch k {
+	case LinkCreate:
+		return "create"
+	case LinkReplaceSymlink:
+		return "replace_symlink"
+	case LinkReplaceFile:
+		return "replace_file"
+	case LinkReplaceDir:
+		return "replace_dir"
+	case LinkSkip:
+		return "skip"
+	case LinkConflict:
+		return "conflict"
+	case LinkSelfReferential:
+		return "self_referential"
+	case LinkRemove:
+		return "remove"
+	case LinkUpdateCopy:
+		return "update_copy"
+	case LinkAdopt:
+		return "adopt"
+	case LinkModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+func (k LinkActionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Refused reports whether an action of this kind will stop a link run.
+func (k LinkActionKind) Refused() bool {
+	return k == LinkConflict || k == LinkSelfReferential || k == LinkModified
+}
+
+// LinkAction is a single planned change to a target path.
+type LinkAction struct {
+	Kind    LinkActionKind `json:"kind"`
+	Source  string         `json:"source"`
+	Target  string         `json:"target"`
+	Profile string         `json:"profile"`
+	Mapping string         `json:"mapping,omitempty"`
+	Reason  string         `json:"reason,omitempty"`
+	// Strategy is the link strategy used to create Target.
+	Strategy string `json:"strategy,omitempty"`
+	// Template is set when Source is rendered into Target.
+	Template bool `json:"template,omitempty"`
+	// Diff is the change a rendered template makes to Target.
+	Diff string `json:"diff,omitempty"`
+}
+
+// Err returns the error that applying a refused action produces.
+func (a LinkAction) Err() error {
+	if !a.Kind.Refused() {
+		return nil
+	}
+
+	return errors.New(a.Reason)
+}
+
+// LinkPlan is every action a link run would take, in the order it would take
+// them: pre modules, the profile itself, then post modules.
+type LinkPlan struct {
+	Actions []LinkAction `json:"actions"`
+}
+
+// Refused returns the actions which would cause the link to fail.
+func (lp *LinkPlan) Refused() []LinkAction {
+	refused := []LinkAction{}
+	for _, action := range lp.Actions {
+		if action.Kind.Refused() {
+			refused = append(refused, action)
+		}
+	}
+
+	return refused
+}
+
+func (lp *LinkPlan) WriteText(w io.Writer) error {
+	for _, action := range lp.Actions {
+		if action.Kind.Refused() {
+			if _, err := fmt.Fprintf(w, "%-16s %s: %s\n", action.Kind, action.Target, action.Reason); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Files matching a skip mapping have no target.
+		line := fmt.Sprintf("%-16s %s", action.Kind, action.Source)
+		if action.Target != "" {
+			line = fmt.Sprintf("%-16s %s -> %s", action.Kind, action.Target, action.Source)
+		}
+
+		if action.Strategy != "" && action.Strategy != mapping.StrategyAbsolute {
+			line += fmt.Sprintf(" [%s]", action.Strategy)
+		}
+
+		if action.Reason != "" {
+			line += fmt.Sprintf(" (%s)", action.Reason)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+
+		for _, diffLine := range splitLines(action.Diff) {
+			if _, err := fmt.Fprintf(w, "    %s\n", diffLine); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// LinkOptions controls how a profile is linked.
+type LinkOptions struct {
+	Overwrite bool
+	// Adopt copies changes made to copied files in the home directory back
+	// into the profile instead of refusing to link.
+	Adopt bool
+	// NoRollback leaves any changes made in place when linking fails instead
+	// of undoing them.
+	NoRollback bool
+	// SwitchFrom are the locations of the previously linked profiles. Links
+	// they created which the new profile does not replace are removed as part
+	// of the link.
+	SwitchFrom []string
+	// Home is the directory to link into instead of the user's home
+	// directory, for example a scratch directory or a container's root
+	// filesystem. Empty means the user's home directory.
+	Home string
+	// Paths limits linking to the files and directories in the profile
+	// within these paths, for example those a changed mapping matches.
+	// Links recorded for sources within them which are no longer planned
+	// are removed. Empty means every path is linked.
+	Paths []string
+}
+
+// linkRun carries the state of a single Link or Plan call across the profile
+// and all of its modules.
+type linkRun struct {
+	opts LinkOptions
+	home string
+
+	// profile is the location of the profile the run was started for, links
+	// made by its modules are recorded under it.
+	profile string
+
+	// manifest records the links made by this run, when planning it is only
+	// read.
+	manifest *manifest.Manifest
+
+	// journal is every change made by this run in the order it was made.
+	journal []change
+
+	// unlinked are the manifest entries of stale links removed by this run,
+	// what they displaced is restored once the run has succeeded.
+	unlinked []manifest.Entry
+
+	// templateData is the data shared by every template rendered by this
+	// run and rendered is the result of rendering each template source.
+	templateData *TemplateData
+	rendered     map[string][]byte
+
+	// planned maps target paths to the source they were planned to point at
+	// earlier in this run so that modules which overlay each other plan
+	// correctly before anything exists on disk.
+	planned map[string]string
+}
+
+func newLinkRun(p *Profile, opts LinkOptions) (*linkRun, error) {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	home := userHome
+	if opts.Home != "" {
+		home, err = filepath.Abs(opts.Home)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Links made in the user's home directory are recorded without a home
+	// so that naming it explicitly makes no difference.
+	opts.Home = ""
+	if home != userHome {
+		opts.Home = home
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &linkRun{
+		opts:     opts,
+		home:     home,
+		profile:  p.config.Location,
+		manifest: m,
+		rendered: map[string][]byte{},
+		planned:  map[string]string{},
+	}, nil
+}
+
+func (r *linkRun) plan(
+	p *Profile,
+	source, target string,
+	deleteDirs bool,
+	m *mapping.Mapping,
+) (LinkAction, error) {
+	template := isTemplate(source, m)
+	if template {
+		target = strings.TrimSuffix(target, TemplateSuffix)
+	}
+
+	action := LinkAction{
+		Source:   source,
+		Target:   target,
+		Profile:  p.config.Location,
+		Strategy: p.linkStrategy(m),
+		Template: template,
+	}
+
+	if m != nil {
+		action.Mapping = m.String()
+	}
+
+	if !mapping.ValidStrategy(action.Strategy) {
+		return action, fmt.Errorf(
+			"unknown link_strategy %q for %s, must be one of %s",
+			action.Strategy,
+			source,
+			strings.Join(mapping.Strategies, ", "),
+		)
+	}
+
+	action.Strategy = mapping.NormalizeStrategy(action.Strategy)
+
+	// Templates can only be copied since what is written is not the
+	// source itself.
+	if template {
+		action.Strategy = mapping.StrategyCopy
+	}
+
+	selfLink, err := wouldCreateSelfReferentialSymlink(source, target)
+	if err != nil {
+		return action, err
+	}
+
+	if selfLink {
+		action.Kind = LinkSelfReferential
+		action.Reason = fmt.Sprintf(
+			"refusing to create symlink %q -> %q because it points to itself; this usually happens when a link_as_dir mapping matches a subdirectory (like .agents/.*) while the parent in $HOME is already a symlink. Use a mapping that matches the directory root too (for example .agents($|/.*))",
+			target,
+			source,
+		)
+		return action, nil
+	}
+
+	defer func() {
+		if !action.Kind.Refused() {
+			r.planned[target] = source
+		}
+	}()
+
+	if previous, ok := r.planned[target]; ok {
+		if previous == source {
+			action.Kind = LinkSkip
+			action.Reason = "already planned"
+		} else {
+			action.Kind = LinkReplaceSymlink
+			action.Reason = fmt.Sprintf("overrides link to %s", previous)
+		}
+
+		return action, nil
+	}
+
+	if action.Strategy == mapping.StrategyCopy {
+		if deleteDirs {
+			action.Kind = LinkConflict
+			action.Reason = fmt.Sprintf("templates and the copy link strategy can not be used for a link_as_dir mapping: %s", target)
+			return action, nil
+		}
+
+		if !template {
+			return r.planCopy(action, nil)
+		}
+
+		content, err := r.render(p, source)
+		if err != nil {
+			return action, err
+		}
+
+		return r.planTemplate(action, content)
+	}
+
+	if action.Strategy == mapping.StrategyHardlink && deleteDirs {
+		action.Kind = LinkConflict
+		action.Reason = fmt.Sprintf("the hardlink link strategy can not be used for a link_as_dir mapping: %s", target)
+		return action, nil
+	}
+
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		action.Kind = LinkCreate
+		return action, nil
+	} else if err != nil {
+		return action, err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		existing, err := os.Readlink(target)
+		if err != nil {
+			return action, err
+		}
+
+		want, err := symlinkText(action.Strategy, source, target)
+		if err != nil {
+			return action, err
+		}
+
+		switch {
+		case action.Strategy != mapping.StrategyHardlink && existing == want:
+			action.Kind = LinkSkip
+			action.Reason = "already linked"
+		case action.Strategy != mapping.StrategyHardlink && utils.ResolveLink(target, existing) == filepath.Clean(source):
+			action.Kind = LinkReplaceSymlink
+			action.Reason = fmt.Sprintf("changing to a %s link", action.Strategy)
+		default:
+			action.Kind = LinkReplaceSymlink
+		}
+	case action.Strategy == mapping.StrategyHardlink && utils.SameFile(target, source):
+		action.Kind = LinkSkip
+		action.Reason = "already linked"
+	case info.IsDir():
+		if deleteDirs {
+			action.Kind = LinkReplaceDir
+		} else {
+			action.Kind = LinkConflict
+			action.Reason = fmt.Sprintf("refusing to remove a directory: %s", target)
+		}
+	case info.Mode().IsRegular() && !r.opts.Overwrite:
+		action.Kind = LinkConflict
+		action.Reason = fmt.Sprintf(
+			"refusing to remove %s because it is a regular file and --overwrite not provided",
+			target,
+		)
+	default:
+		action.Kind = LinkReplaceFile
+	}
+
+	return action, nil
+}
+
+// planCopy classifies the target of an action using the copy strategy. The
+// checksum recorded when dfm last copied the file tells whether it was
+// changed in the home directory since, in which case the change is offered
+// back to the profile instead of being overwritten.
+//
+// content is what will be written to the target, nil means the content of
+// the source.
+func (r *linkRun) planCopy(action LinkAction, content []byte) (LinkAction, error) {
+	info, err := os.Lstat(action.Target)
+	if os.IsNotExist(err) {
+		action.Kind = LinkCreate
+		return action, nil
+	} else if err != nil {
+		return action, err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		action.Kind = LinkReplaceSymlink
+		return action, nil
+	case info.IsDir():
+		action.Kind = LinkConflict
+		action.Reason = fmt.Sprintf("refusing to remove a directory: %s", action.Target)
+		return action, nil
+	case !info.Mode().IsRegular():
+		action.Kind = LinkReplaceFile
+		return action, nil
+	}
+
+	sourceChecksum := utils.ChecksumBytes(content)
+	if content == nil {
+		sourceChecksum, err = utils.Checksum(action.Source)
+		if err != nil {
+			return action, err
+		}
+	}
+
+	targetChecksum, err := utils.Checksum(action.Target)
+	if err != nil {
+		return action, err
+	}
+
+	if sourceChecksum == targetChecksum {
+		action.Kind = LinkSkip
+		action.Reason = "already copied"
+		return action, nil
+	}
+
+	entry, ok := r.manifest.Get(action.Target)
+	copied := ok && entry.Strategy == mapping.StrategyCopy && entry.Checksum != ""
+
+	switch {
+	case copied && targetChecksum == entry.Checksum:
+		action.Kind = LinkUpdateCopy
+		action.Reason = "changed in the profile"
+	// Changes to a rendered template can't be adopted since the template
+	// isn't what was rendered, they can only be replaced.
+	case copied && action.Template && !r.opts.Overwrite:
+		action.Kind = LinkModified
+		action.Reason = fmt.Sprintf(
+			"%s was changed since dfm rendered it, make the change in %s and use --overwrite to replace it",
+			action.Target,
+			action.Source,
+		)
+	case copied && r.opts.Adopt && !action.Template:
+		action.Kind = LinkAdopt
+		action.Reason = "changed in the home directory"
+	case copied && r.opts.Overwrite:
+		action.Kind = LinkReplaceFile
+		action.Reason = "discarding changes made in the home directory"
+	case copied:
+		action.Kind = LinkModified
+		action.Reason = fmt.Sprintf(
+			"%s was changed since dfm copied it, use --adopt to copy the changes into the profile or --overwrite to replace them",
+			action.Target,
+		)
+		if sourceChecksum != entry.Checksum {
+			action.Reason = fmt.Sprintf(
+				"%s was changed since dfm copied it and so was %s, use --adopt to keep the copy or --overwrite to keep the profile's version",
+				action.Target,
+				action.Source,
+			)
+		}
+	case r.opts.Overwrite:
+		action.Kind = LinkReplaceFile
+	default:
+		action.Kind = LinkConflict
+		action.Reason = fmt.Sprintf(
+			"refusing to remove %s because it is a regular file and --overwrite not provided",
+			action.Target,
+		)
+	}
+
+	return action, nil
+}
+
+// planTemplate plans writing the rendered content of a template to the
+// target, including a diff of what will change.
+func (r *linkRun) planTemplate(action LinkAction, content []byte) (LinkAction, error) {
+	action, err := r.planCopy(action, content)
+	if err != nil || action.Kind == LinkSkip {
+		return action, err
+	}
+
+	current := []byte{}
+	if info, err := os.Lstat(action.Target); err == nil && info.Mode().IsRegular() {
+		current, err = os.ReadFile(action.Target)
+		if err != nil {
+			return action, err
+		}
+	}
+
+	action.Diff = unifiedDiff(action.Target, string(current), action.Source+" (rendered)", string(content))
+	return action, nil
+}
+
+// apply performs a planned action and records the resulting link in the
+// manifest.
+func (r *linkRun) apply(p *Profile, action LinkAction) error {
+	switch action.Kind {
+	case LinkSkip:
+		// Links which already existed are recorded so that the manifest
+		// covers links made before it existed.
+		if action.Target == "" {
+			return nil
+		}
+
+		result := linkResult{}
+		if action.Strategy == mapping.StrategyCopy {
+			checksum, err := utils.Checksum(action.Target)
+			if err != nil {
+				return err
+			}
+
+			result.checksum = checksum
+		}
+
+		r.record(action, result)
+		return nil
+	case LinkConflict, LinkSelfReferential, LinkModified:
+		return action.Err()
+	case LinkRemove:
+		return r.removeStale(action)
+	case LinkAdopt:
+		return r.adopt(action)
+	}
+
+	opts := newLinkToOptions(r.opts.Overwrite, action.Source, action.Target)
+	opts.deleteDirs = action.Kind == LinkReplaceDir
+	opts.updateCopy = action.Kind == LinkUpdateCopy
+	opts.strategy = action.Strategy
+	if action.Template {
+		opts.content = r.rendered[action.Source]
+	}
+
+	var result linkResult
+	var err error
+	if action.Strategy == mapping.StrategyCopy {
+		result, err = p.copyTo(opts)
+	} else {
+		result, err = p.linkTo(opts)
+	}
+
+	r.journal = append(r.journal, result)
+	if err != nil {
+		return err
+	}
+
+	r.record(action, result)
+	return nil
+}
+
+func (r *linkRun) record(action LinkAction, result linkResult) {
+	if r.manifest == nil {
+		return
+	}
+
+	entry := manifest.Entry{
+		Target:      action.Target,
+		Source:      action.Source,
+		Profile:     r.profile,
+		Mapping:     action.Mapping,
+		Backup:      result.backup,
+		CreatedDirs: result.createdDirs,
+		Checksum:    result.checksum,
+		Home:        r.opts.Home,
+	}
+
+	if action.Strategy != mapping.StrategyAbsolute {
+		entry.Strategy = action.Strategy
+	}
+
+	if action.Profile != r.profile {
+		entry.Module = action.Profile
+	}
+
+	r.manifest.Record(entry)
+}
+
+// adopt copies a file which was changed in the home directory back into the
+// profile so that the change is kept rather than overwritten.
+func (r *linkRun) adopt(action LinkAction) error {
+	info, err := os.Stat(action.Source)
+	if err != nil {
+		return err
+	}
+
+	previous, err := os.ReadFile(action.Source)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(action.Target)
+	if err != nil {
+		return err
+	}
+
+	r.journal = append(r.journal, adoptedCopy{
+		source:   action.Source,
+		previous: previous,
+		perm:     info.Mode().Perm(),
+	})
+
+	if err := utils.WriteFileAtomic(action.Source, content, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	checksum, err := utils.Checksum(action.Target)
+	if err != nil {
+		return err
+	}
+
+	r.record(action, linkResult{checksum: checksum})
+	return nil
+}
+
+// includes reports whether path is linked by this run, which is every path
+// unless linking is limited to Paths. Directories containing one of the
+// Paths are included so that walking reaches it.
+func (r *linkRun) includes(path string, isDir bool) bool {
+	if len(r.opts.Paths) == 0 {
+		return true
+	}
+
+	for _, included := range r.opts.Paths {
+		if utils.IsWithin(path, included) || (isDir && utils.IsWithin(included, path)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// planStale plans the removal of links recorded for the profiles at the
+// given locations which this run has not planned to replace. When linking is
+// limited to Paths the links recorded for this run's profile within them are
+// included too.
+func (r *linkRun) planStale(locations []string) []LinkAction {
+	actions := []LinkAction{}
+	for _, location := range locations {
+		if location == r.profile {
+			continue
+		}
+
+		actions = append(actions, r.planStaleEntries(location, "not in the new profile", func(manifest.Entry) bool {
+			return true
+		})...)
+	}
+
+	if len(r.opts.Paths) > 0 {
+		actions = append(actions, r.planStaleEntries(r.profile, "no longer linked by the profile", func(entry manifest.Entry) bool {
+			return r.includes(entry.Source, false)
+		})...)
+	}
+
+	return actions
+}
+
+// planStaleEntries plans the removal of the links recorded for the profile
+// at location which stale accepts and this run has not planned to replace.
+func (r *linkRun) planStaleEntries(location, reason string, stale func(manifest.Entry) bool) []LinkAction {
+	actions := []LinkAction{}
+	entries := r.manifest.ForProfile(location)
+	slices.Reverse(entries)
+
+	for _, entry := range entries {
+		if _, ok := r.planned[entry.Target]; ok || !stale(entry) {
+			continue
+		}
+
+		// Links made in another home directory belong to a different
+		// installation of the profile.
+		if entry.Home != r.opts.Home {
+			continue
+		}
+
+		action := LinkAction{
+			Kind:    LinkRemove,
+			Source:  entry.Source,
+			Target:  entry.Target,
+			Profile: location,
+			Mapping: entry.Mapping,
+			Reason:  reason,
+		}
+
+		if entry.Module != "" {
+			action.Profile = entry.Module
+		}
+
+		if _, err := os.Lstat(entry.Target); err == nil && !entry.Owns() {
+			action.Kind = LinkSkip
+			action.Reason = "link was changed since dfm created it"
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
+// removeStaleLinks removes the links planned by planStale.
+func (r *linkRun) removeStaleLinks(p *Profile, locations []string) error {
+	for _, action := range r.planStale(locations) {
+		if action.Kind != LinkRemove {
+			continue
+		}
+
+		if err := r.apply(p, action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *linkRun) removeStale(action LinkAction) error {
+	entry, ok := r.manifest.Get(action.Target)
+	if !ok {
+		return nil
+	}
+
+	removal, err := newRemovedLink(entry)
+	if err != nil {
+		return err
+	}
+
+	removed, err := removeOwnedLink(entry)
+	if err != nil || !removed {
+		return err
+	}
+
+	r.journal = append(r.journal, removal)
+	r.manifest.Remove(entry.Target)
+	r.unlinked = append(r.unlinked, entry)
+	return nil
+}
+
+// LayerConflict is a target path claimed by more than one active profile.
+type LayerConflict struct {
+	Target string
+	// Layers are the profiles claiming Target from the bottom layer to the
+	// top, the last one wins.
+	Layers []string
+}
+
+// FindLayerConflicts returns the target paths which more than one of the
+// given plans links. Plans must be ordered from the bottom layer to the top
+// and layers names the profile each plan is for.
+func FindLayerConflicts(layers []string, plans []*LinkPlan) []LayerConflict {
+	claims := map[string][]string{}
+	targets := []string{}
+	for idx, plan := range plans {
+		for _, action := range plan.Actions {
+			if action.Target == "" || action.Kind == LinkRemove || action.Kind.Refused() {
+				continue
+			}
+
+			claimed := claims[action.Target]
+			if len(claimed) > 0 && claimed[len(claimed)-1] == layers[idx] {
+				continue
+			}
+
+			if len(claimed) == 0 {
+				targets = append(targets, action.Target)
+			}
+
+			claims[action.Target] = append(claimed, layers[idx])
+		}
+	}
+
+	conflicts := []LayerConflict{}
+	for _, target := range targets {
+		if len(claims[target]) > 1 {
+			conflicts = append(conflicts, LayerConflict{Target: target, Layers: claims[target]})
+		}
+	}
+
+	return conflicts
+}
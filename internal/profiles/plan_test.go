@@ -0,0 +1,292 @@
+package profiles
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func planKinds(plan *LinkPlan) map[string]LinkActionKind {
+	kinds := map[string]LinkActionKind{}
+	for _, action := range plan.Actions {
+		kinds[filepath.Base(action.Target)] = action.Kind
+	}
+
+	return kinds
+}
+
+func TestPlanClassifiesTargets(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{"new", "linked", "stale", "file", "dir"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(repo, "linked"), filepath.Join(home, "linked")); err != nil {
+		t.Fatalf("failed to create existing link: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join(t.TempDir(), "elsewhere"), filepath.Join(home, "stale")); err != nil {
+		t.Fatalf("failed to create stale link: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(home, "file"), []byte("mine"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(home, "dir"), 0755); err != nil {
+		t.Fatalf("failed to create existing dir: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	plan, err := p.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	expected := map[string]LinkActionKind{
+		"new":    LinkCreate,
+		"linked": LinkSkip,
+		"stale":  LinkReplaceSymlink,
+		"file":   LinkConflict,
+		"dir":    LinkConflict,
+	}
+
+	kinds := planKinds(plan)
+	for name, want := range expected {
+		if kinds[name] != want {
+			t.Errorf("%s planned as %s, want %s", name, kinds[name], want)
+		}
+	}
+
+	if len(plan.Refused()) != 2 {
+		t.Fatalf("expected 2 refused actions, got %d", len(plan.Refused()))
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, "new")); !os.IsNotExist(err) {
+		t.Fatalf("Plan should not create links, got err=%v", err)
+	}
+
+	plan, err = p.Plan(LinkOptions{Overwrite: true})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)["file"]; kind != LinkReplaceFile {
+		t.Fatalf("file planned as %s with overwrite, want %s", kind, LinkReplaceFile)
+	}
+}
+
+func TestPlanLinkAsDirReplacesDirectory(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(repo, "snippets"), 0755); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, "snippets"), 0755); err != nil {
+		t.Fatalf("failed to create target dir: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{
+		Location: repo,
+		Mappings: []*mapping.Mapping{{Match: "snippets$", LinkAsDir: true}},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	plan, err := p.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if len(plan.Actions) != 1 || plan.Actions[0].Kind != LinkReplaceDir {
+		t.Fatalf("expected a single replace_dir action, got %+v", plan.Actions)
+	}
+}
+
+func TestPlanOrdersModulesAndTracksOverrides(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	pre := t.TempDir()
+	post := t.TempDir()
+
+	for _, dir := range []string{repo, pre, post} {
+		if err := os.WriteFile(filepath.Join(dir, "shared"), []byte("data"), 0644); err != nil {
+			t.Fatalf("failed to write shared file: %v", err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{
+		Location: repo,
+		Modules: []config.Config{
+			{Location: post},
+			{Location: pre, LinkMode: "pre"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	plan, err := p.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if len(plan.Actions) != 3 {
+		t.Fatalf("expected 3 actions, got %+v", plan.Actions)
+	}
+
+	wantProfiles := []string{pre, repo, post}
+	wantKinds := []LinkActionKind{LinkCreate, LinkReplaceSymlink, LinkReplaceSymlink}
+	for idx, action := range plan.Actions {
+		if action.Profile != wantProfiles[idx] {
+			t.Errorf("action %d profile = %q, want %q", idx, action.Profile, wantProfiles[idx])
+		}
+
+		if action.Kind != wantKinds[idx] {
+			t.Errorf("action %d kind = %s, want %s", idx, action.Kind, wantKinds[idx])
+		}
+	}
+}
+
+func TestPlanReplacesModifiedTemplateWithOverwrite(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(repo, ".rc.tmpl"), []byte("{{ .Vars.a }}\n"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{Location: repo, Variables: map[string]any{"a": "rendered"}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := p.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	target := filepath.Join(home, ".rc")
+	if err := os.WriteFile(target, []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("failed to modify rendered template: %v", err)
+	}
+
+	plan, err := p.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".rc"]; kind != LinkModified {
+		t.Fatalf(".rc planned as %s without overwrite, want %s", kind, LinkModified)
+	}
+
+	// Adopting a rendered file into its template would lose the template.
+	plan, err = p.Plan(LinkOptions{Overwrite: true, Adopt: true})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".rc"]; kind != LinkReplaceFile {
+		t.Fatalf(".rc planned as %s with overwrite, want %s", kind, LinkReplaceFile)
+	}
+
+	if err := p.Link(LinkOptions{Overwrite: true}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if content, err := os.ReadFile(target); err != nil || string(content) != "rendered\n" {
+		t.Fatalf("expected the rendered template to replace the change, got %q, %v", content, err)
+	}
+}
+
+func TestLinkPlanOutput(t *testing.T) {
+	plan := &LinkPlan{Actions: []LinkAction{
+		{Kind: LinkCreate, Source: "/repo/foo", Target: "/home/foo"},
+		{Kind: LinkConflict, Source: "/repo/bar", Target: "/home/bar", Reason: "refusing"},
+		{Kind: LinkSkip, Source: "/repo/LICENSE", Reason: "matched skip mapping"},
+	}}
+
+	var text strings.Builder
+	if err := plan.WriteText(&text); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+
+	if !strings.Contains(text.String(), "create           /home/foo -> /repo/foo") {
+		t.Fatalf("unexpected text output: %q", text.String())
+	}
+
+	if !strings.Contains(text.String(), "conflict         /home/bar: refusing") {
+		t.Fatalf("unexpected text output: %q", text.String())
+	}
+
+	if !strings.Contains(text.String(), "skip             /repo/LICENSE (matched skip mapping)\n") {
+		t.Fatalf("expected skipped files to be printed without a target, got %q", text.String())
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("json.Marshal returned error: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"kind":"create"`) {
+		t.Fatalf("expected kinds to marshal as strings, got %s", data)
+	}
+}
+
+func TestFindLayerConflicts(t *testing.T) {
+	base := &LinkPlan{Actions: []LinkAction{
+		{Kind: LinkCreate, Source: "/base/.vimrc", Target: "/home/.vimrc"},
+		{Kind: LinkCreate, Source: "/base/.bashrc", Target: "/home/.bashrc"},
+		{Kind: LinkSkip, Source: "/base/README.md", Reason: "matched skip mapping"},
+	}}
+	work := &LinkPlan{Actions: []LinkAction{
+		{Kind: LinkReplaceSymlink, Source: "/work/.bashrc", Target: "/home/.bashrc"},
+		{Kind: LinkCreate, Source: "/work/.gitconfig", Target: "/home/.gitconfig"},
+		{Kind: LinkSkip, Source: "/work/README.md", Reason: "matched skip mapping"},
+	}}
+
+	conflicts := FindLayerConflicts([]string{"base", "work"}, []*LinkPlan{base, work})
+	if len(conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %+v", conflicts)
+	}
+
+	conflict := conflicts[0]
+	if conflict.Target != "/home/.bashrc" {
+		t.Fatalf("Target = %s, want /home/.bashrc", conflict.Target)
+	}
+
+	if strings.Join(conflict.Layers, ",") != "base,work" {
+		t.Fatalf("Layers = %v, want [base work]", conflict.Layers)
+	}
+}
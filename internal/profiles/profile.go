@@ -8,10 +8,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/chasinglogic/dfm/internal/backup"
 	"github.com/chasinglogic/dfm/internal/config"
 	"github.com/chasinglogic/dfm/internal/logger"
+	"github.com/chasinglogic/dfm/internal/manifest"
 	"github.com/chasinglogic/dfm/internal/mapping"
 	"github.com/chasinglogic/dfm/internal/utils"
 )
@@ -19,12 +24,30 @@ import (
 type Profile struct {
 	config  *config.Config
 	modules []*Profile
+
+	// variables are the template variables for this profile including
+	// those inherited from the profile it is a module of.
+	variables map[string]any
+
+	// defaults are the built in mappings, empty if the profile opted out.
+	defaults []*mapping.Mapping
 }
 
 func New(config *config.Config) (*Profile, error) {
+	return newProfile(config, nil)
+}
+
+// newProfile creates a profile whose templates can use the given inherited
+// variables, its own variables take precedence over them.
+func newProfile(cfg *config.Config, inherited map[string]any) (*Profile, error) {
 	profile := Profile{
-		config:  config,
-		modules: make([]*Profile, len(config.Modules)),
+		config:    cfg,
+		modules:   make([]*Profile, 0, len(cfg.Modules)),
+		variables: config.MergeVariables(inherited, cfg.Variables),
+	}
+
+	if cfg.UseDefaultMappings() {
+		profile.defaults = mapping.Defaults()
 	}
 
 	return &profile, profile.loadModules()
@@ -40,8 +63,15 @@ func Load(profilePath string) (*Profile, error) {
 }
 
 func (p *Profile) loadModules() error {
-	for idx, moduleConfig := range p.config.Modules {
-		module, err := New(&moduleConfig)
+	for _, moduleConfig := range p.config.Modules {
+		if !moduleConfig.When.Matches() {
+			logger.Debug().
+				Str("location", moduleConfig.Location).
+				Msg("skipping module because its when condition does not match")
+			continue
+		}
+
+		module, err := newProfile(&moduleConfig, p.variables)
 		if err != nil {
 			return err
 		}
@@ -50,7 +80,7 @@ func (p *Profile) loadModules() error {
 			return err
 		}
 
-		p.modules[idx] = module
+		p.modules = append(p.modules, module)
 	}
 
 	return nil
@@ -64,128 +94,463 @@ func (p *Profile) ensureDownloaded() error {
 	return nil
 }
 
-func (p *Profile) Link(overwrite bool) error {
+// Link creates the links for the profile and all of its modules in the home
+// directory, running the link hooks around each.
+func (p *Profile) Link(opts LinkOptions) error {
+	return LinkLayers([]*Profile{p}, opts)
+}
+
+// pruneBackups applies the profile's backup retention policy, keeping any
+// backup unlink would need to restore.
+func (p *Profile) pruneBackups(m *manifest.Manifest) error {
+	protected := map[string]bool{}
+	for _, entry := range m.Entries() {
+		if entry.Backup != "" {
+			protected[entry.Backup] = true
+		}
+	}
+
+	pruned, err := backup.Prune(p.config.BackupRetention(), protected)
+	for _, b := range pruned {
+		logger.Debug().
+			Str("id", b.ID).
+			Str("original", b.Original).
+			Msg("pruned backup")
+	}
+
+	return err
+}
+
+// Plan computes what Link would do without touching the filesystem.
+func (p *Profile) Plan(opts LinkOptions) (*LinkPlan, error) {
+	run, err := newLinkRun(p, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &LinkPlan{Actions: []LinkAction{}}
+	if err := p.plan(run, plan); err != nil {
+		return plan, err
+	}
+
+	plan.Actions = append(plan.Actions, run.planStale(opts.SwitchFrom)...)
+	return plan, nil
+}
+
+func (p *Profile) link(run *linkRun) error {
 	if err := p.RunHook("pre_link"); err != nil {
 		return err
 	}
 
-	home, err := os.UserHomeDir()
+	for _, profile := range p.modules {
+		if profile.config.LinkMode == "pre" {
+			if err := profile.link(run); err != nil {
+				return err
+			}
+		}
+	}
+
+	actions, err := p.planOwn(run)
 	if err != nil {
 		return err
 	}
 
+	for _, action := range actions {
+		if action.Kind.Refused() {
+			return action.Err()
+		}
+	}
+
+	for _, action := range actions {
+		if err := run.apply(p, action); err != nil {
+			return err
+		}
+	}
+
+	for _, profile := range p.modules {
+		if profile.config.LinkMode != "pre" {
+			if err := profile.link(run); err != nil {
+				return err
+			}
+		}
+	}
+
+	return p.RunHook("post_link")
+}
+
+func (p *Profile) plan(run *linkRun, plan *LinkPlan) error {
 	for _, profile := range p.modules {
 		if profile.config.LinkMode == "pre" {
-			if err := profile.Link(overwrite); err != nil {
+			if err := profile.plan(run, plan); err != nil {
 				return err
 			}
 		}
 	}
 
+	actions, err := p.planOwn(run)
+	if err != nil {
+		return err
+	}
+
+	plan.Actions = append(plan.Actions, actions...)
+
+	for _, profile := range p.modules {
+		if profile.config.LinkMode != "pre" {
+			if err := profile.plan(run, plan); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// linkRoot is a directory in the profile whose contents are linked under
+// target.
+type linkRoot struct {
+	dir    string
+	target string
+}
+
+// isHome reports whether root links into the home directory, only then do
+// the default mappings move files into other roots.
+func (root linkRoot) isHome(run *linkRun) bool {
+	return root.target == run.home
+}
+
+// linkRoots returns the directories of the profile which are walked when
+// linking. Without targets that is the dotfile directory linked into the
+// home directory.
+func (p *Profile) linkRoots(home string) ([]linkRoot, error) {
+	targets := p.config.LinkTargets()
+	if len(targets) == 0 {
+		return []linkRoot{{dir: p.config.GetDotfileDirectory(), target: home}}, nil
+	}
+
+	roots := make([]linkRoot, 0, len(targets))
+	for _, t := range targets {
+		dir := filepath.Clean(filepath.FromSlash(t.Dir))
+		if dir == "." || !filepath.IsLocal(dir) {
+			return nil, fmt.Errorf(
+				"target directory %q in %s must be a subdirectory of the profile",
+				t.Dir,
+				p.config.Location,
+			)
+		}
+
+		for _, other := range roots {
+			otherDir, err := filepath.Rel(p.config.GetDotfileDirectory(), other.dir)
+			if err != nil {
+				return nil, err
+			}
+
+			if utils.IsWithin(dir, otherDir) {
+				return nil, fmt.Errorf("target directories %q and %q overlap", otherDir, t.Dir)
+			}
+		}
+
+		target, err := mapping.ResolveRoot(t.Root, home)
+		if err != nil {
+			return nil, fmt.Errorf("target directory %q: %w", t.Dir, err)
+		}
+
+		roots = append(roots, linkRoot{
+			dir:    filepath.Join(p.config.GetDotfileDirectory(), dir),
+			target: target,
+		})
+	}
+
+	return roots, nil
+}
+
+// planOwn plans the links for this profile's dotfile directory, not including
+// modules.
+func (p *Profile) planOwn(run *linkRun) ([]LinkAction, error) {
 	logger.Debug().Interface("config", p.config).Msg("starting link")
 
-	err = filepath.WalkDir(
-		p.config.GetDotfileDirectory(),
+	roots, err := p.linkRoots(run.home)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []LinkAction{}
+	for _, root := range roots {
+		rootActions, err := p.planRoot(run, root)
+		actions = append(actions, rootActions...)
+		if err != nil {
+			return actions, err
+		}
+	}
+
+	return actions, nil
+}
+
+// planRoot plans the links for the files in root.
+func (p *Profile) planRoot(run *linkRun, root linkRoot) ([]LinkAction, error) {
+	actions := []LinkAction{}
+	err := filepath.WalkDir(
+		root.dir,
 		func(path string, d fs.DirEntry, err error) error {
 			if d == nil {
 				return nil
 			}
 
-			if d.IsDir() {
-				if filepath.Base(path) == ".git" {
-					logger.Debug().
-						Str("path", path).
-						Msg("skipping because it is the git directory")
+			if !run.includes(path, d.IsDir()) {
+				if d.IsDir() {
 					return filepath.SkipDir
 				}
-			}
-
-			if filepath.Base(path) == ".dfm.yml" {
-				logger.Debug().
-					Str("path", path).
-					Msg("skipping because it is the dfm config file")
 
 				return nil
 			}
 
-			for _, m := range p.config.Mappings {
-				if m.IsMatch(path) {
-					logger.Debug().
-						Str("mapping", m.String()).
-						Str("path", path).
-						Msg("matched mapping")
-
-					return p.handleMapping(
-						overwrite,
-						path,
-						d,
-						m,
-						home,
-					)
-				}
-			}
-
-			if d.IsDir() {
-				return nil
+			action, planned, err := p.planPath(run, root, path, d, nil)
+			if planned {
+				actions = append(actions, action)
 			}
 
-			return p.linkTo(newLinkToOptions(overwrite, path, home))
+			return err
 		},
 	)
+
+	return actions, err
+}
+
+// planPath plans the action for a single path found walking root. The
+// returned bool reports whether an action was planned and the returned error
+// may be filepath.SkipDir to stop walking into a directory. Each decision is
+// recorded in tr, which may be nil.
+func (p *Profile) planPath(
+	run *linkRun,
+	root linkRoot,
+	path string,
+	d fs.DirEntry,
+	tr *trace,
+) (LinkAction, bool, error) {
+	if d.IsDir() {
+		if filepath.Base(path) == ".git" {
+			logger.Debug().
+				Str("path", path).
+				Msg("skipping because it is the git directory")
+			tr.note(path, "skipped because it is the git directory")
+			return LinkAction{}, false, filepath.SkipDir
+		}
+	}
+
+	if filepath.Base(path) == ".dfm.yml" || filepath.Base(path) == config.LocalConfigFile ||
+		slices.Contains(p.config.IncludedFiles(), path) {
+		logger.Debug().
+			Str("path", path).
+			Msg("skipping because it is a dfm config file")
+		tr.note(path, "skipped because it is a dfm config file")
+		return LinkAction{}, false, nil
+	}
+
+	rel, err := relativePath(root, path)
 	if err != nil {
-		return err
+		return LinkAction{}, false, err
 	}
 
-	for _, profile := range p.modules {
-		if profile.config.LinkMode != "pre" {
-			if err := profile.Link(overwrite); err != nil {
-				return err
-			}
+	for _, m := range p.defaults {
+		if m.Action() != mapping.ActionSkip {
+			continue
+		}
+
+		matched, reason := m.Check(path, rel)
+		tr.mapping(path, "default", m, matched, reason)
+		if matched {
+			logger.Debug().
+				Str("mapping", m.String()).
+				Str("path", path).
+				Msg("matched default mapping")
+
+			action, _, err := p.handleMapping(run, root, path, d, m)
+			return action, true, err
 		}
 	}
 
-	return p.RunHook("post_link")
+	// A profile's own mappings see paths relative to the dotfile directory
+	// whichever target they are in.
+	profileRel, err := relativePath(linkRoot{dir: p.config.GetDotfileDirectory()}, path)
+	if err != nil {
+		return LinkAction{}, false, err
+	}
+
+	for idx, m := range p.config.Mappings {
+		matched, reason := m.Check(path, profileRel)
+		tr.mapping(path, fmt.Sprintf("mappings[%d]", idx), m, matched, reason)
+		if matched {
+			logger.Debug().
+				Str("mapping", m.String()).
+				Str("path", path).
+				Msg("matched mapping")
+
+			return p.handleMapping(run, root, path, d, m)
+		}
+	}
+
+	if d.IsDir() {
+		return LinkAction{}, false, nil
+	}
+
+	target, err := p.homeTarget(run, root, path, nil)
+	if err != nil {
+		return LinkAction{}, false, err
+	}
+
+	action, err := run.plan(p, path, target, false, nil)
+	return action, err == nil, err
 }
 
+// handleMapping plans the action for a path which matched m. The returned
+// bool reports whether an action was planned, the returned error may be
+// filepath.SkipDir to stop walking into a directory.
 func (p *Profile) handleMapping(
-	overwrite bool,
+	run *linkRun,
+	root linkRoot,
 	path string,
 	entry fs.DirEntry,
 	m *mapping.Mapping,
-	home string,
-) error {
+) (LinkAction, bool, error) {
 	isDir := entry != nil && entry.IsDir()
 
 	switch m.Action() {
-	case mapping.ActionSkip, mapping.ActionNone:
-		if isDir && m.Action() == mapping.ActionSkip {
-			return filepath.SkipDir
+	case mapping.ActionNone:
+		// A mapping may only change the link strategy, target root or
+		// mark templates, files it matches are otherwise linked as usual.
+		if (m.LinkStrategy == "" && !m.Template && m.TargetRoot == "") || isDir {
+			return LinkAction{}, false, nil
 		}
 
-		return nil
+		target, err := p.homeTarget(run, root, path, m)
+		if err != nil {
+			return LinkAction{}, false, err
+		}
+
+		action, err := run.plan(p, path, target, false, m)
+		return action, err == nil, err
+	case mapping.ActionSkip:
+		action := LinkAction{
+			Kind:    LinkSkip,
+			Source:  path,
+			Profile: p.config.Location,
+			Mapping: m.String(),
+			Reason:  "matched skip mapping",
+		}
+
+		if isDir {
+			return action, true, filepath.SkipDir
+		}
+
+		return action, true, nil
 	case mapping.ActionLinkAsDir:
-		targetPath := path
+		sourcePath := path
 		if !isDir {
-			targetPath = filepath.Dir(path)
+			sourcePath = filepath.Dir(path)
 		}
 
-		opts := newLinkToOptions(overwrite, targetPath, home)
-		opts.deleteDirs = true
+		target, err := p.homeTarget(run, root, sourcePath, m)
+		if err != nil {
+			return LinkAction{}, false, err
+		}
 
-		if err := p.linkTo(opts); err != nil {
-			return err
+		action, err := run.plan(p, sourcePath, target, true, m)
+		if err != nil {
+			return action, false, err
 		}
 
 		if isDir {
-			return filepath.SkipDir
+			return action, true, filepath.SkipDir
 		}
 
-		return nil
+		return action, true, nil
 	case mapping.ActionTranslate:
-		return p.linkTo(newLinkToOptions(overwrite, path, m.Dest))
+		target, err := targetPath(root, path, m.Dest)
+		if err != nil {
+			return LinkAction{}, false, err
+		}
+
+		action, err := run.plan(p, path, target, false, m)
+		return action, err == nil, err
 	default:
-		return fmt.Errorf("unhandled map action: %s", m.Action())
+		return LinkAction{}, false, fmt.Errorf("unhandled map action: %s", m.Action())
+	}
+}
+
+// linkStrategy returns the link strategy for a file matched by m, which may be
+// nil. Mappings override the profile's strategy.
+func (p *Profile) linkStrategy(m *mapping.Mapping) string {
+	if m != nil && m.LinkStrategy != "" {
+		return m.LinkStrategy
 	}
+
+	if p.config.LinkStrategy != "" {
+		return p.config.LinkStrategy
+	}
+
+	return mapping.StrategyAbsolute
+}
+
+// symlinkText returns what a symlink at target pointing at source holds for
+// the given strategy.
+func symlinkText(strategy, source, target string) (string, error) {
+	if strategy != mapping.StrategyRelative {
+		return source, nil
+	}
+
+	return filepath.Rel(filepath.Dir(target), source)
+}
+
+// relativePath returns the slash separated path of path relative to the
+// directory of root, which is what default mappings are matched against.
+func relativePath(root linkRoot, path string) (string, error) {
+	rel, err := filepath.Rel(root.dir, path)
+	return filepath.ToSlash(rel), err
+}
+
+// homeTarget returns where path should be linked under the target of root.
+// The target root of m, which may be nil, or the default mappings may move it
+// elsewhere such as into $XDG_CONFIG_HOME.
+func (p *Profile) homeTarget(run *linkRun, root linkRoot, path string, m *mapping.Mapping) (string, error) {
+	if m != nil && m.TargetRoot != "" {
+		dir, err := mapping.ResolveRoot(m.TargetRoot, run.home)
+		if err != nil {
+			return "", err
+		}
+
+		return targetPath(root, path, dir)
+	}
+
+	if !root.isHome(run) {
+		return targetPath(root, path, root.target)
+	}
+
+	rel, err := relativePath(root, path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range p.defaults {
+		if !d.IsMatch(path, rel) {
+			continue
+		}
+
+		if target, ok := d.Translate(rel, run.home); ok {
+			return target, nil
+		}
+	}
+
+	return targetPath(root, path, run.home)
+}
+
+// targetPath returns where path should be linked when its position relative
+// to the directory of root is preserved under targetDir.
+func targetPath(root linkRoot, path, targetDir string) (string, error) {
+	rel, err := filepath.Rel(root.dir, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(targetDir, rel), nil
 }
 
 type linkToOptions struct {
@@ -193,6 +558,14 @@ type linkToOptions struct {
 	path       string
 	target     string
 	deleteDirs bool
+	// strategy is the link strategy to use, "" is an absolute symlink.
+	strategy string
+	// updateCopy replaces a copy dfm made earlier in place instead of
+	// moving it into the backup store.
+	updateCopy bool
+	// content, when set, is written by copyTo instead of the content of
+	// path.
+	content []byte
 }
 
 func newLinkToOptions(overwrite bool, path, target string) linkToOptions {
@@ -216,47 +589,224 @@ func (lo linkToOptions) validate() error {
 	return nil
 }
 
-func (p *Profile) linkTo(opts linkToOptions) error {
+// linkResult describes the changes linkTo made, it is filled in as far as
+// linkTo got even when it returns an error so the changes can be undone.
+type linkResult struct {
+	target string
+	source string
+
+	// linked is set when a symlink holding linkText was created at target,
+	// hardlinked when a hard link was.
+	linked     bool
+	linkText   string
+	hardlinked bool
+
+	backup       string
+	replacedLink string
+	createdDirs  []string
+
+	// copied is set when target was written as a copy of source, checksum
+	// is the checksum of what was written and previous is the content of
+	// the copy it replaced if any.
+	copied       bool
+	checksum     string
+	previous     []byte
+	previousPerm os.FileMode
+}
+
+// linkTo creates a symlink or hard link at opts.target pointing to opts.path.
+// Regular files and directories which opts allows replacing are moved into
+// the backup store, anything else in the way is removed.
+func (p *Profile) linkTo(opts linkToOptions) (linkResult, error) {
+	result := linkResult{target: opts.target, source: opts.path}
 	if err := opts.validate(); err != nil {
-		return err
+		return result, err
 	}
 
-	rel, err := filepath.Rel(p.config.GetDotfileDirectory(), opts.path)
+	logger.Debug().
+		Str("path", opts.path).
+		Str("targetPath", opts.target).
+		Msg("link")
+
+	var err error
+	result.backup, err = displace(opts)
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	targetPath := filepath.Join(opts.target, rel)
+	if existing, err := os.Readlink(opts.target); err == nil {
+		result.replacedLink = existing
+	}
+
+	if err := deleteIfExists(opts, opts.target); err != nil {
+		return result, err
+	}
+
+	createdDirs, err := missingDirs(filepath.Dir(opts.target))
+	if err != nil {
+		return result, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(opts.target), 0744)
+	result.createdDirs = createdDirs
+	if err != nil {
+		return result, err
+	}
+
+	if opts.strategy == mapping.StrategyHardlink {
+		if err := os.Link(opts.path, opts.target); errors.Is(err, syscall.EXDEV) {
+			return result, fmt.Errorf(
+				"can not hard link %s to %s because they are on different filesystems: %w",
+				opts.target,
+				opts.path,
+				err,
+			)
+		} else if err != nil {
+			return result, err
+		}
+
+		result.hardlinked = true
+		return result, nil
+	}
+
+	linkText, err := symlinkText(opts.strategy, opts.path, opts.target)
+	if err != nil {
+		return result, err
+	}
+
+	if err := os.Symlink(linkText, opts.target); err != nil {
+		return result, err
+	}
+
+	result.linked = true
+	result.linkText = linkText
+	return result, nil
+}
+
+// copyTo writes a copy of opts.path to opts.target. Anything in the way is
+// handled the same way as linkTo except an earlier copy being updated, which
+// is kept in memory so that it can be put back if the run is rolled back.
+func (p *Profile) copyTo(opts linkToOptions) (linkResult, error) {
+	result := linkResult{target: opts.target, source: opts.path}
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
 
 	logger.Debug().
-		Str("relativePath", rel).
-		Str("targetDirectory", opts.target).
 		Str("path", opts.path).
-		Str("targetPath", targetPath).
-		Msg("link")
+		Str("targetPath", opts.target).
+		Bool("update", opts.updateCopy).
+		Msg("copy")
 
-	selfLink, err := wouldCreateSelfReferentialSymlink(opts.path, targetPath)
+	info, err := os.Stat(opts.path)
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	if selfLink {
-		return fmt.Errorf(
-			"refusing to create symlink %q -> %q because it points to itself; this usually happens when a link_as_dir mapping matches a subdirectory (like .agents/.*) while the parent in $HOME is already a symlink. Use a mapping that matches the directory root too (for example .agents($|/.*))",
-			targetPath,
-			opts.path,
-		)
+	content := opts.content
+	if content == nil {
+		content, err = os.ReadFile(opts.path)
+		if err != nil {
+			return result, err
+		}
 	}
 
-	if err := deleteIfExists(opts, targetPath); err != nil {
-		return err
+	if opts.updateCopy {
+		previousInfo, err := os.Stat(opts.target)
+		if err != nil {
+			return result, err
+		}
+
+		result.previous, err = os.ReadFile(opts.target)
+		if err != nil {
+			return result, err
+		}
+
+		result.previousPerm = previousInfo.Mode().Perm()
+	} else {
+		result.backup, err = displace(opts)
+		if err != nil {
+			return result, err
+		}
+
+		if existing, err := os.Readlink(opts.target); err == nil {
+			result.replacedLink = existing
+		}
+
+		if err := deleteIfExists(opts, opts.target); err != nil {
+			return result, err
+		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(targetPath), 0744); err != nil {
-		return err
+	createdDirs, err := missingDirs(filepath.Dir(opts.target))
+	if err != nil {
+		return result, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(opts.target), 0744)
+	result.createdDirs = createdDirs
+	if err != nil {
+		return result, err
+	}
+
+	if err := utils.WriteFileAtomic(opts.target, content, info.Mode().Perm()); err != nil {
+		return result, err
+	}
+
+	result.copied = true
+	result.checksum, err = utils.Checksum(opts.target)
+	return result, err
+}
+
+// displace moves the regular file or directory at opts.target into the backup
+// store if opts allows replacing it. It returns the ID of the backup or "" if
+// nothing was moved.
+func displace(opts linkToOptions) (string, error) {
+	info, err := os.Lstat(opts.target)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if (info.IsDir() && opts.deleteDirs) || (info.Mode().IsRegular() && opts.overwrite) {
+		b, err := backup.Move(opts.target)
+		if err != nil {
+			return "", err
+		}
+
+		logger.Debug().
+			Str("path", opts.target).
+			Str("backup", b.ID).
+			Msg("moved existing file to backup")
+
+		return b.ID, nil
 	}
 
-	return os.Symlink(opts.path, targetPath)
+	return "", nil
+}
+
+// missingDirs returns dir and each of its parents which do not exist yet,
+// deepest first.
+func missingDirs(dir string) ([]string, error) {
+	missing := []string{}
+	for {
+		_, err := os.Lstat(dir)
+		if err == nil {
+			return missing, nil
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		missing = append(missing, dir)
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return missing, nil
+		}
+
+		dir = parent
+	}
 }
 
 func wouldCreateSelfReferentialSymlink(sourcePath, targetPath string) (bool, error) {
@@ -318,9 +868,66 @@ func (p *Profile) GetDotfileDirectory() string {
 	return p.config.GetDotfileDirectory()
 }
 
+// SourcePath returns where the file at path belongs in the profile so that
+// linking the profile puts it back at path. It returns the path relative to
+// the dotfile directory as well as the absolute one.
+func (p *Profile) SourcePath(path, home string) (string, string, error) {
+	roots, err := p.linkRoots(home)
+	if err != nil {
+		return "", "", err
+	}
+
+	// The deepest target which contains path wins so that a target for
+	// $XDG_CONFIG_HOME is preferred over one for the home directory.
+	var best *linkRoot
+	rel := ""
+	for idx, root := range roots {
+		var candidate string
+		if root.target == home {
+			// Files from an XDG directory go where the default
+			// mappings link them from.
+			candidate, err = mapping.ProfilePath(path, home)
+			if err != nil {
+				continue
+			}
+		} else if utils.IsWithin(path, root.target) {
+			candidate, err = filepath.Rel(root.target, path)
+			if err != nil {
+				return "", "", err
+			}
+		} else {
+			continue
+		}
+
+		if best == nil || len(root.target) > len(best.target) {
+			best, rel = &roots[idx], candidate
+		}
+	}
+
+	if best == nil {
+		return "", "", fmt.Errorf("%s is not in any of the target directories of %s", path, p.config.Location)
+	}
+
+	source := filepath.Join(best.dir, rel)
+	rel, err = filepath.Rel(p.config.GetDotfileDirectory(), source)
+	return rel, source, err
+}
+
+// AddMapping adds m to the mappings in the profile's .dfm.yml. The
+// machine-local config is left out of the file so that it isn't committed.
 func (p *Profile) AddMapping(m *mapping.Mapping) error {
+	committed, err := config.LoadCommitted(filepath.Join(p.config.Location, ".dfm.yml"))
+	if err != nil {
+		return err
+	}
+
+	committed.Mappings = append(committed.Mappings, m)
+	if err := committed.Save(); err != nil {
+		return err
+	}
+
 	p.config.Mappings = append(p.config.Mappings, m)
-	return p.config.Save()
+	return nil
 }
 
 func (p *Profile) isDirty() bool {
@@ -340,12 +947,53 @@ func (p *Profile) isDirty() bool {
 	return buf.String() != ""
 }
 
+// excludeLocalConfig adds the profile's machine-local config to the
+// repository's info/exclude file, so that syncing never commits it even when
+// it isn't in the profile's .gitignore.
+func (p *Profile) excludeLocalConfig() error {
+	if _, err := os.Stat(filepath.Join(p.config.Location, config.LocalConfigFile)); err != nil {
+		return nil
+	}
+
+	out, err := utils.RunInOutput(p.config.Location, "git", "rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return fmt.Errorf("failed to find the git exclude file of %s: %w", p.config.Location, err)
+	}
+
+	excludeFile := strings.TrimSpace(out)
+	if !filepath.IsAbs(excludeFile) {
+		excludeFile = filepath.Join(p.config.Location, excludeFile)
+	}
+
+	pattern := "/" + config.LocalConfigFile
+	content, err := os.ReadFile(excludeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if slices.Contains(strings.Split(string(content), "\n"), pattern) {
+		return nil
+	}
+
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(excludeFile), 0755); err != nil {
+		return err
+	}
+
+	logger.Debug().Str("file", excludeFile).Msg("excluding the machine-local config from git")
+	return utils.WriteFileAtomic(excludeFile, append(content, pattern+"\n"...), 0644)
+}
+
 func (p *Profile) Sync(commitMessage string) error {
 	started := time.Now()
+	llmSettings := p.config.LLMSettings()
 	logger.Debug().
 		Str("location", p.config.Location).
 		Bool("pullOnly", p.config.PullOnly).
-		Bool("llmCommitMessages", p.config.LLM.CommitMessages).
+		Bool("llmCommitMessages", llmSettings.CommitMessages).
 		Bool("promptForCommitMessage", p.config.PromptForCommitMessage).
 		Msg("starting sync")
 
@@ -353,6 +1001,10 @@ func (p *Profile) Sync(commitMessage string) error {
 		return err
 	}
 
+	if err := p.excludeLocalConfig(); err != nil {
+		return err
+	}
+
 	fmt.Println("Syncing", p.GetLocation())
 	if !p.isDirty() || p.config.PullOnly {
 		logger.Debug().Str("location", p.config.Location).Msg("working tree clean or pull-only; pulling")
@@ -360,18 +1012,18 @@ func (p *Profile) Sync(commitMessage string) error {
 			return err
 		}
 	} else {
-		if commitMessage == "" && p.config.LLM.CommitMessages {
+		if commitMessage == "" && llmSettings.CommitMessages {
 			logger.Debug().
 				Str("location", p.config.Location).
-				Str("provider", p.config.LLM.ModelProvider).
-				Str("model", p.config.LLM.Model).
+				Str("provider", llmSettings.ModelProvider).
+				Str("model", llmSettings.Model).
 				Msg("generating commit message with LLM")
 			var err error
 			commitMessage, err = commitMessageFromLLM(
 				p.config.Location,
-				p.config.LLM.ModelProvider,
-				p.config.LLM.Model,
-				p.config.LLM.CommitMessagePrompt,
+				llmSettings.ModelProvider,
+				llmSettings.Model,
+				llmSettings.CommitMessagePrompt,
 			)
 			if err != nil {
 				return err
@@ -6,8 +6,11 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/chasinglogic/dfm/internal/condition"
 	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
 	"github.com/chasinglogic/dfm/internal/mapping"
+	"github.com/chasinglogic/dfm/internal/utils"
 )
 
 func TestLinkCreatesSymlinkInHome(t *testing.T) {
@@ -19,6 +22,8 @@ func TestLinkCreatesSymlinkInHome(t *testing.T) {
 	}
 
 	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
 
 	cfg := &config.Config{Location: repo}
 	p, err := New(cfg)
@@ -26,7 +31,7 @@ func TestLinkCreatesSymlinkInHome(t *testing.T) {
 		t.Fatalf("New returned error: %v", err)
 	}
 
-	if err := p.Link(false); err != nil {
+	if err := p.Link(LinkOptions{}); err != nil {
 		t.Fatalf("Link returned error: %v", err)
 	}
 
@@ -64,6 +69,8 @@ func TestLinkSkipsGitAndConfigFiles(t *testing.T) {
 	}
 
 	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
 
 	cfg := &config.Config{Location: repo}
 	p, err := New(cfg)
@@ -71,7 +78,7 @@ func TestLinkSkipsGitAndConfigFiles(t *testing.T) {
 		t.Fatalf("New returned error: %v", err)
 	}
 
-	if err := p.Link(false); err != nil {
+	if err := p.Link(LinkOptions{}); err != nil {
 		t.Fatalf("Link returned error: %v", err)
 	}
 
@@ -84,6 +91,47 @@ func TestLinkSkipsGitAndConfigFiles(t *testing.T) {
 	}
 }
 
+func TestLinkSkipsIncludedConfigFiles(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	files := map[string]string{
+		".dfm.yml":                           "include:\n  - dfm/mappings.yml\n",
+		filepath.Join("dfm", "mappings.yml"): "include:\n  - hooks.yml\n",
+		filepath.Join("dfm", "hooks.yml"):    "hooks:\n  post_link:\n    - echo linked\n",
+		filepath.Join("dfm", "notes"):        "linked",
+	}
+
+	if err := os.Mkdir(filepath.Join(repo, "dfm"), 0755); err != nil {
+		t.Fatalf("failed to create dfm directory: %v", err)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := Load(repo)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	plan, err := p.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	kinds := planKinds(plan)
+	if len(plan.Actions) != 1 || kinds["notes"] != LinkCreate {
+		t.Fatalf("expected only dfm/notes to be linked, got %+v", plan.Actions)
+	}
+}
+
 func TestLinkAppliesTranslateMapping(t *testing.T) {
 	home := t.TempDir()
 	repo := t.TempDir()
@@ -100,6 +148,8 @@ func TestLinkAppliesTranslateMapping(t *testing.T) {
 	}
 
 	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
 
 	cfg := &config.Config{
 		Location: repo,
@@ -111,7 +161,7 @@ func TestLinkAppliesTranslateMapping(t *testing.T) {
 		t.Fatalf("New returned error: %v", err)
 	}
 
-	if err := p.Link(false); err != nil {
+	if err := p.Link(LinkOptions{}); err != nil {
 		t.Fatalf("Link returned error: %v", err)
 	}
 
@@ -217,6 +267,8 @@ func TestLinkRejectsSelfReferentialLinkAsDir(t *testing.T) {
 	}
 
 	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
 
 	cfg := &config.Config{
 		Location: repo,
@@ -231,7 +283,7 @@ func TestLinkRejectsSelfReferentialLinkAsDir(t *testing.T) {
 		t.Fatalf("New returned error: %v", err)
 	}
 
-	err = p.Link(true)
+	err = p.Link(LinkOptions{Overwrite: true})
 	if err == nil {
 		t.Fatalf("expected Link to fail with self-referential symlink error")
 	}
@@ -244,3 +296,531 @@ func TestLinkRejectsSelfReferentialLinkAsDir(t *testing.T) {
 		t.Fatalf("expected existing directory contents to be preserved, got: %v", statErr)
 	}
 }
+
+func TestLinkRecordsManifest(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	module := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(repo, "foo"), []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to write file in repo: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(module, "bar"), []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to write file in module: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{
+		Location: repo,
+		Modules:  []config.Config{{Location: module}},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := p.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	foo, ok := m.Get(filepath.Join(home, "foo"))
+	if !ok {
+		t.Fatal("expected foo to be recorded in the manifest")
+	}
+
+	if foo.Source != filepath.Join(repo, "foo") || foo.Profile != repo || foo.Module != "" {
+		t.Fatalf("unexpected manifest entry for foo: %+v", foo)
+	}
+
+	bar, ok := m.Get(filepath.Join(home, "bar"))
+	if !ok {
+		t.Fatal("expected bar to be recorded in the manifest")
+	}
+
+	if bar.Profile != repo || bar.Module != module {
+		t.Fatalf("unexpected manifest entry for bar: %+v", bar)
+	}
+}
+
+func TestLinkAppliesDefaultMappings(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{"README.md", "LICENSE", ".gitignore", ".ggitignore", ".bashrc", "config/nvim/init.lua", ".config/git/config"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+
+	profile, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	for _, name := range []string{"README.md", "LICENSE", ".ggitignore", "config", ".config"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be linked into home, got %v", name, err)
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(home, ".bashrc"):         filepath.Join(repo, ".bashrc"),
+		filepath.Join(home, ".gitignore"):      filepath.Join(repo, ".ggitignore"),
+		filepath.Join(xdg, "nvim", "init.lua"): filepath.Join(repo, "config", "nvim", "init.lua"),
+		filepath.Join(xdg, "git", "config"):    filepath.Join(repo, ".config", "git", "config"),
+	}
+
+	for target, source := range links {
+		if got, err := os.Readlink(target); err != nil || got != source {
+			t.Fatalf("expected %s -> %s, got %q, %v", target, source, got, err)
+		}
+	}
+}
+
+func TestLinkWithoutDefaultMappings(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("readme"), 0644); err != nil {
+		t.Fatalf("failed to write README.md: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	useDefaults := false
+	profile, err := New(&config.Config{Location: repo, DefaultMappings: &useDefaults})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, "README.md")); err != nil {
+		t.Fatalf("expected README.md to be linked with default mappings off: %v", err)
+	}
+}
+
+func TestLinkUsesNamedTargetRoots(t *testing.T) {
+	home := t.TempDir()
+	data := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{".local/share/fonts/mono.ttf", "applications/editor.desktop"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", data)
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Mappings: []*mapping.Mapping{
+			{Match: `/applications/`, TargetRoot: mapping.RootXDGData},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	for _, target := range []string{
+		filepath.Join(data, "fonts", "mono.ttf"),
+		filepath.Join(data, "applications", "editor.desktop"),
+	} {
+		if _, err := os.Readlink(target); err != nil {
+			t.Fatalf("expected %s to be linked: %v", target, err)
+		}
+	}
+}
+
+func TestLinkWalksEachTarget(t *testing.T) {
+	home := t.TempDir()
+	xdg := t.TempDir()
+	etc := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{"README.md", "home/.bashrc", "home/.config/git/config", "xdg/nvim/init.lua", "etc/hosts", "notes/todo.txt"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Targets: map[string]string{
+			"home": mapping.RootHome,
+			"xdg":  mapping.RootXDGConfig,
+			"etc":  etc,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	links := map[string]string{
+		filepath.Join(home, ".bashrc"):         filepath.Join(repo, "home", ".bashrc"),
+		filepath.Join(xdg, "git", "config"):    filepath.Join(repo, "home", ".config", "git", "config"),
+		filepath.Join(xdg, "nvim", "init.lua"): filepath.Join(repo, "xdg", "nvim", "init.lua"),
+		filepath.Join(etc, "hosts"):            filepath.Join(repo, "etc", "hosts"),
+	}
+
+	for target, source := range links {
+		if got, err := os.Readlink(target); err != nil || got != source {
+			t.Fatalf("expected %s -> %s, got %q, %v", target, source, got, err)
+		}
+	}
+
+	for _, name := range []string{"README.md", "notes", "home", "xdg", "etc"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to be linked into home, got %v", name, err)
+		}
+	}
+
+	for _, path := range []string{filepath.Join(xdg, ".config"), filepath.Join(home, ".config", "git")} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s not to exist, got %v", path, err)
+		}
+	}
+}
+
+func TestLinkRejectsInvalidTargets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	cases := map[string]map[string]string{
+		"overlapping": {"home": mapping.RootHome, "home/.config": mapping.RootXDGConfig},
+		"escaping":    {"../elsewhere": mapping.RootHome},
+		"unknown":     {"home": "xdg_cache"},
+	}
+
+	for name, targets := range cases {
+		profile, err := New(&config.Config{Location: t.TempDir(), Targets: targets})
+		if err != nil {
+			t.Fatalf("%s: New returned error: %v", name, err)
+		}
+
+		if err := profile.Link(LinkOptions{}); err == nil {
+			t.Fatalf("%s: expected Link to return an error", name)
+		}
+	}
+}
+
+func TestSourcePathUsesTargets(t *testing.T) {
+	home := t.TempDir()
+	etc := t.TempDir()
+	repo := t.TempDir()
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Targets: map[string]string{
+			"home": mapping.RootHome,
+			"xdg":  mapping.RootXDGConfig,
+			"etc":  etc,
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	cases := map[string]string{
+		filepath.Join(home, ".bashrc"):                 filepath.Join("home", ".bashrc"),
+		filepath.Join(home, ".config", "nvim", "init"): filepath.Join("xdg", "nvim", "init"),
+		filepath.Join(etc, "hosts"):                    filepath.Join("etc", "hosts"),
+	}
+
+	for path, want := range cases {
+		rel, source, err := profile.SourcePath(path, home)
+		if err != nil {
+			t.Fatalf("SourcePath(%s) returned error: %v", path, err)
+		}
+
+		if rel != want || source != filepath.Join(repo, want) {
+			t.Fatalf("SourcePath(%s) = %s, %s, want %s", path, rel, source, want)
+		}
+	}
+
+	if _, _, err := profile.SourcePath("/somewhere/else", home); err == nil {
+		t.Fatal("expected a path outside every target to return an error")
+	}
+}
+
+func TestLinkIntoAnotherHome(t *testing.T) {
+	home := t.TempDir()
+	scratch := t.TempDir()
+	repo := t.TempDir()
+	other := t.TempDir()
+
+	for _, name := range []string{".bashrc", ".config/nvim/init.lua"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(other, ".zshrc"), []byte("zsh"), 0644); err != nil {
+		t.Fatalf("failed to write .zshrc: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+
+	profile, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{Home: scratch}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	for _, name := range []string{".bashrc", ".config/nvim/init.lua"} {
+		target := filepath.Join(scratch, name)
+		if got, err := os.Readlink(target); err != nil || got != filepath.Join(repo, name) {
+			t.Fatalf("expected %s to be linked into the scratch directory, got %q, %v", target, got, err)
+		}
+	}
+
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatalf("failed to read home: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected nothing to be linked into the home directory, found %v", entries)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if entry, ok := m.Get(filepath.Join(scratch, ".bashrc")); !ok || entry.Home != scratch {
+		t.Fatalf("expected the manifest to record the scratch directory, got %+v", entry)
+	}
+
+	// Switching profiles in the home directory leaves the links made in the
+	// scratch directory alone.
+	otherProfile, err := New(&config.Config{Location: other})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := otherProfile.Link(LinkOptions{SwitchFrom: []string{repo}}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	if _, err := os.Readlink(filepath.Join(scratch, ".bashrc")); err != nil {
+		t.Fatalf("expected the scratch link to be kept: %v", err)
+	}
+}
+
+func TestLinkAppliesGlobAndPathMappings(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	for _, name := range []string{"notes.md", "docs/guide.md", "bin/tool", ".vim/colors/dark.vim", "extra/.vim/ignored"} {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Mappings: []*mapping.Mapping{
+			{Glob: "**/*.md", Skip: true},
+			{Path: ".vim", LinkAsDir: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	for _, name := range []string{"notes.md", "docs"} {
+		if _, err := os.Lstat(filepath.Join(home, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be skipped, got %v", name, err)
+		}
+	}
+
+	links := map[string]string{
+		filepath.Join(home, ".vim"):                     filepath.Join(repo, ".vim"),
+		filepath.Join(home, "bin", "tool"):              filepath.Join(repo, "bin", "tool"),
+		filepath.Join(home, "extra", ".vim", "ignored"): filepath.Join(repo, "extra", ".vim", "ignored"),
+	}
+
+	for target, source := range links {
+		if got, err := os.Readlink(target); err != nil || got != source {
+			t.Fatalf("expected %s -> %s, got %q, %v", target, source, got, err)
+		}
+	}
+}
+
+func TestNewSkipsModulesWhoseConditionDoesNotMatch(t *testing.T) {
+	repo := t.TempDir()
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{
+		Location: repo,
+		Modules: []config.Config{
+			{
+				Repo:     "https://example.invalid/never-cloned.git",
+				Location: filepath.Join(t.TempDir(), "never-cloned"),
+				When:     &condition.Condition{Env: condition.List{"!PATH"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if len(profile.modules) != 0 {
+		t.Fatalf("expected the module to be skipped, got %d modules", len(profile.modules))
+	}
+}
+
+// git runs git with args in dir, failing the test if it fails.
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	out, err := utils.RunInOutput(dir, append([]string{"git"}, args...)...)
+	if err != nil {
+		t.Fatalf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+
+	return out
+}
+
+func TestSyncDoesNotCommitLocalConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "dfm")
+	t.Setenv("GIT_AUTHOR_EMAIL", "dfm@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "dfm")
+	t.Setenv("GIT_COMMITTER_EMAIL", "dfm@example.com")
+
+	remote := t.TempDir()
+	git(t, remote, "init", "--bare", "--quiet")
+
+	repo := t.TempDir()
+	git(t, repo, "clone", "--quiet", remote, ".")
+	if err := os.WriteFile(filepath.Join(repo, ".vimrc"), []byte("set number"), 0644); err != nil {
+		t.Fatalf("failed to write file in repo: %v", err)
+	}
+
+	git(t, repo, "add", "--all")
+	git(t, repo, "commit", "--quiet", "--message", "initial")
+	git(t, repo, "push", "--quiet", "origin", "HEAD")
+	git(t, repo, "branch", "--quiet", "--set-upstream-to", "origin/"+strings.TrimSpace(git(t, repo, "branch", "--show-current")))
+
+	if err := os.WriteFile(filepath.Join(repo, config.LocalConfigFile), []byte("pull_only: false\n"), 0644); err != nil {
+		t.Fatalf("failed to write local config: %v", err)
+	}
+
+	p, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := p.Sync("sync"); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	if status := git(t, repo, "status", "--porcelain"); status != "" {
+		t.Fatalf("expected the local config to be ignored, got status:\n%s", status)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, ".vimrc"), []byte("set relativenumber"), 0644); err != nil {
+		t.Fatalf("failed to write file in repo: %v", err)
+	}
+
+	if err := p.Sync("sync"); err != nil {
+		t.Fatalf("Sync returned error: %v", err)
+	}
+
+	if files := git(t, remote, "ls-tree", "-r", "--name-only", "HEAD"); files != ".vimrc\n" {
+		t.Fatalf("expected only .vimrc to be pushed, got:\n%s", files)
+	}
+
+	exclude, err := os.ReadFile(filepath.Join(repo, ".git", "info", "exclude"))
+	if err != nil || strings.Count(string(exclude), "/"+config.LocalConfigFile+"\n") != 1 {
+		t.Fatalf("expected the local config to be excluded once, got %q, %v", exclude, err)
+	}
+}
@@ -0,0 +1,179 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func TestLinkRelativeStrategy(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	source := filepath.Join(repo, ".vimrc")
+	target := filepath.Join(home, ".vimrc")
+
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	absolute, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := absolute.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	relative, err := New(&config.Config{Location: repo, LinkStrategy: mapping.StrategyRelative})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	plan, err := relative.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".vimrc"]; kind != LinkReplaceSymlink {
+		t.Fatalf("expected the absolute link to be replaced, got %s", kind)
+	}
+
+	if err := relative.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	linkText, err := os.Readlink(target)
+	if err != nil {
+		t.Fatalf("expected a symlink: %v", err)
+	}
+
+	if filepath.IsAbs(linkText) {
+		t.Fatalf("expected a relative link, got %s", linkText)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	entry, _ := m.Get(target)
+	if entry.Strategy != mapping.StrategyRelative || !entry.Owns() {
+		t.Fatalf("expected the manifest to own the relative link, got %+v", entry)
+	}
+
+	plan, err = relative.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".vimrc"]; kind != LinkSkip {
+		t.Fatalf("expected the relative link to be recognised, got %s", kind)
+	}
+}
+
+func TestLinkHardlinkStrategy(t *testing.T) {
+	base := t.TempDir()
+	home := filepath.Join(base, "home")
+	repo := filepath.Join(base, "repo")
+	source := filepath.Join(repo, ".vimrc")
+	target := filepath.Join(home, ".vimrc")
+
+	for _, dir := range []string{home, repo} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo, LinkStrategy: mapping.StrategyHardlink})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	targetInfo, err := os.Lstat(target)
+	if err != nil {
+		t.Fatalf("expected a hard link: %v", err)
+	}
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		t.Fatalf("failed to stat source: %v", err)
+	}
+
+	if !os.SameFile(targetInfo, sourceInfo) {
+		t.Fatal("expected the target to be a hard link to the source")
+	}
+
+	plan, err := profile.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if kind := planKinds(plan)[".vimrc"]; kind != LinkSkip {
+		t.Fatalf("expected the hard link to be recognised, got %s", kind)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	result, err := Unlink(m, repo)
+	if err != nil {
+		t.Fatalf("Unlink returned error: %v", err)
+	}
+
+	if len(result.Removed) != 1 {
+		t.Fatalf("expected the hard link to be removed, got %+v", result)
+	}
+
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("expected target to be gone, got %v", err)
+	}
+
+	if _, err := os.Stat(source); err != nil {
+		t.Fatalf("expected source to remain: %v", err)
+	}
+}
+
+func TestLinkRejectsUnknownStrategy(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(repo, ".vimrc"), []byte("data"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo, LinkStrategy: "softlink"})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err == nil {
+		t.Fatal("expected an unknown link strategy to fail")
+	}
+}
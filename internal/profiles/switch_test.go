@@ -0,0 +1,124 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+func TestLinkSwitchRemovesStaleLinks(t *testing.T) {
+	home := t.TempDir()
+	oldRepo := t.TempDir()
+	newRepo := t.TempDir()
+
+	for _, name := range []string{".oldonly", ".shared"} {
+		if err := os.WriteFile(filepath.Join(oldRepo, name), []byte("old"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{".newonly", ".shared"} {
+		if err := os.WriteFile(filepath.Join(newRepo, name), []byte("new"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".oldonly"), []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	oldProfile, err := New(&config.Config{Location: oldRepo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := oldProfile.Link(LinkOptions{Overwrite: true}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	newProfile, err := New(&config.Config{Location: newRepo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	plan, err := newProfile.Plan(LinkOptions{SwitchFrom: []string{oldRepo}})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	kinds := planKinds(plan)
+	if kinds[".oldonly"] != LinkRemove || kinds[".shared"] != LinkReplaceSymlink || kinds[".newonly"] != LinkCreate {
+		t.Fatalf("unexpected switch plan: %+v", plan.Actions)
+	}
+
+	if err := newProfile.Link(LinkOptions{SwitchFrom: []string{oldRepo}}); err != nil {
+		t.Fatalf("Link with SwitchFrom returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(home, ".oldonly"))
+	if err != nil {
+		t.Fatalf("expected the file replaced by the old profile to be restored: %v", err)
+	}
+
+	if string(content) != "original" {
+		t.Fatalf(".oldonly content = %q, want %q", content, "original")
+	}
+
+	link, err := os.Readlink(filepath.Join(home, ".shared"))
+	if err != nil || link != filepath.Join(newRepo, ".shared") {
+		t.Fatalf("expected .shared to point at the new profile, got %q err=%v", link, err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	if entries := m.ForProfile(oldRepo); len(entries) != 0 {
+		t.Fatalf("expected no links to remain for the old profile, got %+v", entries)
+	}
+
+	if entries := m.ForProfile(newRepo); len(entries) != 2 {
+		t.Fatalf("expected 2 links for the new profile, got %+v", entries)
+	}
+}
+
+func TestLinkWithoutSwitchKeepsOverlay(t *testing.T) {
+	home := t.TempDir()
+	base := t.TempDir()
+	overlay := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(base, ".emacs"), []byte("base"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(overlay, ".gitconfig"), []byte("work"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	for _, location := range []string{base, overlay} {
+		p, err := New(&config.Config{Location: location})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+
+		if err := p.Link(LinkOptions{}); err != nil {
+			t.Fatalf("Link returned error: %v", err)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".emacs")); err != nil {
+		t.Fatalf("expected base profile link to remain, got err=%v", err)
+	}
+}
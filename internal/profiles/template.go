@@ -0,0 +1,125 @@
+package profiles
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+// TemplateSuffix marks a file in a profile as a template. Templates are
+// rendered into the target instead of being linked and the suffix is removed
+// from the target path.
+const TemplateSuffix = ".tmpl"
+
+// TemplateData is the data templates are rendered with.
+type TemplateData struct {
+	Hostname string
+	OS       string
+	Arch     string
+	User     string
+	Home     string
+	Env      map[string]string
+	// Vars are the variables from the profile's config, including those
+	// of the profile a module belongs to and the machine-local config.
+	Vars map[string]any
+}
+
+var templateFuncs = template.FuncMap{
+	// env returns the value of an environment variable or "" if it is not
+	// set, unlike .Env which fails to render for unset variables.
+	"env": os.Getenv,
+}
+
+func isTemplate(source string, m *mapping.Mapping) bool {
+	return strings.HasSuffix(source, TemplateSuffix) || (m != nil && m.Template)
+}
+
+func newTemplateData(home string) (TemplateData, error) {
+	data := TemplateData{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		Home: home,
+		Env:  map[string]string{},
+	}
+
+	var err error
+	data.Hostname, err = os.Hostname()
+	if err != nil {
+		return data, err
+	}
+
+	if current, err := user.Current(); err == nil {
+		data.User = current.Username
+	} else {
+		data.User = os.Getenv("USER")
+	}
+
+	for _, variable := range os.Environ() {
+		key, value, _ := strings.Cut(variable, "=")
+		data.Env[key] = value
+	}
+
+	return data, nil
+}
+
+// render renders the template at source for p, the result is kept so that
+// applying the plan writes exactly what was planned.
+func (r *linkRun) render(p *Profile, source string) ([]byte, error) {
+	if content, ok := r.rendered[source]; ok {
+		return content, nil
+	}
+
+	if r.templateData == nil {
+		data, err := newTemplateData(r.home)
+		if err != nil {
+			return nil, err
+		}
+
+		r.templateData = &data
+	}
+
+	data := *r.templateData
+	data.Vars = p.variables
+	if data.Vars == nil {
+		data.Vars = map[string]any{}
+	}
+
+	content, err := renderTemplate(source, data)
+	if err != nil {
+		return nil, err
+	}
+
+	r.rendered[source] = content
+	return content, nil
+}
+
+// renderTemplate renders the template file at path. The template is named
+// after path so that errors point at the file and line they came from.
+func renderTemplate(path string, data TemplateData) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(path).
+		Option("missingkey=error").
+		Funcs(templateFuncs).
+		Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	// Always non-nil, even when the template renders nothing.
+	return append([]byte{}, out.Bytes()...), nil
+}
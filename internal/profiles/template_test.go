@@ -0,0 +1,170 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/mapping"
+)
+
+func TestLinkRendersTemplates(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	moduleRepo := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(repo, ".gitconfig.tmpl"):      "email = {{ .Vars.email }}\nos = {{ .OS }}\n",
+		filepath.Join(repo, ".profile"):             "host={{ .Hostname }}",
+		filepath.Join(repo, config.LocalConfigFile): "variables:\n  email: me@work.example\n",
+		filepath.Join(moduleRepo, ".modrc.tmpl"):    "{{ .Vars.email }} {{ .Vars.editor }}",
+	}
+
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, ".dfm.yml"), []byte("variables:\n  email: me@home.example\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	cfg, err := config.Load(filepath.Join(repo, ".dfm.yml"))
+	if err != nil {
+		t.Fatalf("config.Load returned error: %v", err)
+	}
+
+	cfg.Mappings = []*mapping.Mapping{{Match: `\.profile$`, Template: true}}
+	cfg.Modules = []config.Config{{
+		Location:  moduleRepo,
+		Variables: map[string]any{"editor": "vim"},
+	}}
+
+	profile, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("os.Hostname returned error: %v", err)
+	}
+
+	want := map[string]string{
+		".gitconfig": "email = me@work.example\nos = " + runtime.GOOS + "\n",
+		".profile":   "host=" + hostname,
+		".modrc":     "me@work.example vim",
+	}
+
+	for name, content := range want {
+		if got := readFile(t, filepath.Join(home, name)); got != content {
+			t.Fatalf("%s = %q, want %q", name, got, content)
+		}
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".gitconfig.tmpl")); !os.IsNotExist(err) {
+		t.Fatalf("expected the template suffix to be removed from the target, got %v", err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, config.LocalConfigFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected the local config file not to be linked, got %v", err)
+	}
+}
+
+func TestPlanShowsRenderedDiff(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(repo, ".rc.tmpl"), []byte("a\n{{ .Vars.b }}\nc\n"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo, Variables: map[string]any{"b": "new"}})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := profile.Link(LinkOptions{}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	profile.variables["b"] = "newer"
+
+	plan, err := profile.Plan(LinkOptions{})
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	if len(plan.Actions) != 1 || plan.Actions[0].Kind != LinkUpdateCopy {
+		t.Fatalf("unexpected plan: %+v", plan.Actions)
+	}
+
+	var text strings.Builder
+	if err := plan.WriteText(&text); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+
+	if !strings.Contains(text.String(), "    -new\n    +newer\n") {
+		t.Fatalf("expected the rendered diff in the plan, got:\n%s", text.String())
+	}
+}
+
+func TestTemplateErrorsNameFileAndLine(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+	source := filepath.Join(repo, ".rc.tmpl")
+
+	if err := os.WriteFile(source, []byte("ok\n{{ .Vars.missing }}\n"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	profile, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	err = profile.Link(LinkOptions{})
+	if err == nil {
+		t.Fatal("expected Link to fail for a missing variable")
+	}
+
+	if !strings.Contains(err.Error(), source+":2") {
+		t.Fatalf("expected error to point at %s:2, got %v", source, err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".rc")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	diff := unifiedDiff("old", "a\nb\nc\n", "new", "a\nB\nc\nd\n")
+	want := "--- old\n+++ new\n@@ -1,3 +1,4 @@\n a\n-b\n+B\n c\n+d\n"
+	if diff != want {
+		t.Fatalf("unifiedDiff =\n%s\nwant\n%s", diff, want)
+	}
+
+	if diff := unifiedDiff("old", "same\n", "new", "same\n"); diff != "" {
+		t.Fatalf("expected no diff for identical text, got %q", diff)
+	}
+}
@@ -0,0 +1,116 @@
+package profiles
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/chasinglogic/dfm/internal/backup"
+	"github.com/chasinglogic/dfm/internal/logger"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+// UnlinkResult describes what Unlink did to each manifest entry.
+type UnlinkResult struct {
+	Removed  []manifest.Entry
+	Restored []manifest.Entry
+	Refused  []manifest.Entry
+}
+
+// Unlink removes every link recorded in m for the profile at location,
+// including those made by its modules. Anything the links displaced is
+// restored and directories created for the links are removed if they are now
+// empty. Links which no longer point where dfm pointed them are left alone
+// and reported as refused.
+func Unlink(m *manifest.Manifest, location string) (UnlinkResult, error) {
+	result := UnlinkResult{}
+	entries := m.ForProfile(location)
+
+	// Deepest targets first so that links inside linked directories are
+	// handled before their parents.
+	slices.Reverse(entries)
+
+	for _, entry := range entries {
+		removed, err := removeOwnedLink(entry)
+		if err != nil {
+			return result, err
+		}
+
+		if !removed {
+			result.Refused = append(result.Refused, entry)
+			continue
+		}
+
+		m.Remove(entry.Target)
+		result.Removed = append(result.Removed, entry)
+	}
+
+	restored, err := restoreUnlinked(result.Removed)
+	result.Restored = restored
+	return result, err
+}
+
+// removeOwnedLink removes the link entry describes if it still points where
+// dfm pointed it. It reports whether the entry no longer has a link, a
+// missing link counts as removed.
+func removeOwnedLink(entry manifest.Entry) (bool, error) {
+	_, err := os.Lstat(entry.Target)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if !entry.Owns() {
+		logger.Debug().
+			Str("target", entry.Target).
+			Str("source", entry.Source).
+			Msg("refusing to unlink because the link was changed since dfm created it")
+		return false, nil
+	}
+
+	return true, os.Remove(entry.Target)
+}
+
+// restoreUnlinked restores whatever the links of the given removed entries
+// displaced and removes the directories created for them which are now
+// empty. It returns the entries which had something restored.
+func restoreUnlinked(entries []manifest.Entry) ([]manifest.Entry, error) {
+	restored := []manifest.Entry{}
+	createdDirs := []string{}
+	for _, entry := range entries {
+		if entry.Backup != "" {
+			if _, err := backup.Restore(entry.Backup); err != nil {
+				return restored, err
+			}
+
+			restored = append(restored, entry)
+		}
+
+		createdDirs = append(createdDirs, entry.CreatedDirs...)
+	}
+
+	slices.SortFunc(createdDirs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+
+	for _, dir := range slices.Compact(createdDirs) {
+		if err := removeIfEmpty(dir); err != nil {
+			return restored, err
+		}
+	}
+
+	return restored, nil
+}
+
+func removeIfEmpty(dir string) error {
+	err := os.Remove(dir)
+	if err == nil || os.IsNotExist(err) || errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,95 @@
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chasinglogic/dfm/internal/config"
+	"github.com/chasinglogic/dfm/internal/manifest"
+)
+
+func TestUnlinkRemovesLinksAndRestoresDisplacedFiles(t *testing.T) {
+	home := t.TempDir()
+	repo := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(repo, ".config", "tool"), 0755); err != nil {
+		t.Fatalf("failed to create source dirs: %v", err)
+	}
+
+	for _, name := range []string{".bashrc", ".vimrc", filepath.Join(".config", "tool", "config")} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte("profile"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write existing file: %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(home, ".config"), 0755); err != nil {
+		t.Fatalf("failed to create existing .config: %v", err)
+	}
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	p, err := New(&config.Config{Location: repo})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	if err := p.Link(LinkOptions{Overwrite: true}); err != nil {
+		t.Fatalf("Link returned error: %v", err)
+	}
+
+	// Something other than dfm re-points one of the links.
+	vimrc := filepath.Join(home, ".vimrc")
+	if err := os.Remove(vimrc); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+
+	if err := os.Symlink(filepath.Join(t.TempDir(), "vimrc"), vimrc); err != nil {
+		t.Fatalf("failed to re-point link: %v", err)
+	}
+
+	m, err := manifest.Load()
+	if err != nil {
+		t.Fatalf("manifest.Load returned error: %v", err)
+	}
+
+	result, err := Unlink(m, repo)
+	if err != nil {
+		t.Fatalf("Unlink returned error: %v", err)
+	}
+
+	if len(result.Removed) != 2 || len(result.Restored) != 1 || len(result.Refused) != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	content, err := os.ReadFile(filepath.Join(home, ".bashrc"))
+	if err != nil {
+		t.Fatalf("expected .bashrc to be restored: %v", err)
+	}
+
+	if string(content) != "original" {
+		t.Fatalf(".bashrc content = %q, want %q", content, "original")
+	}
+
+	if _, err := os.Lstat(filepath.Join(home, ".config", "tool")); !os.IsNotExist(err) {
+		t.Fatalf("expected created directory to be removed, got err=%v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(home, ".config")); err != nil {
+		t.Fatalf("expected pre-existing directory to remain, got err=%v", err)
+	}
+
+	if _, err := os.Lstat(vimrc); err != nil {
+		t.Fatalf("expected re-pointed link to remain, got err=%v", err)
+	}
+
+	if len(m.ForProfile(repo)) != 1 {
+		t.Fatalf("expected only the refused entry to remain, got %+v", m.ForProfile(repo))
+	}
+}
@@ -4,10 +4,56 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+
+	"github.com/chasinglogic/dfm/internal/mapping"
 )
 
 type appState struct {
+	// CurrentProfile is the top most active profile, commands which work on
+	// a single profile use it.
 	CurrentProfile string
+	// ActiveProfiles are the linked profiles ordered from the bottom layer to
+	// the top, links from higher layers win over those from lower ones.
+	ActiveProfiles []string
+}
+
+// Active returns the active profiles from the bottom layer to the top.
+func (s *appState) Active() []string {
+	// State saved before layers existed only has a current profile.
+	if len(s.ActiveProfiles) == 0 && s.CurrentProfile != "" {
+		return []string{s.CurrentProfile}
+	}
+
+	return slices.Clone(s.ActiveProfiles)
+}
+
+// SetActive makes profile the only active profile.
+func (s *appState) SetActive(profile string) {
+	s.ActiveProfiles = []string{profile}
+	s.CurrentProfile = profile
+}
+
+// PushLayer makes profile the top layer, moving it there if it is already
+// active.
+func (s *appState) PushLayer(profile string) {
+	s.ActiveProfiles = slices.DeleteFunc(s.Active(), func(active string) bool {
+		return active == profile
+	})
+	s.ActiveProfiles = append(s.ActiveProfiles, profile)
+	s.CurrentProfile = profile
+}
+
+// Deactivate removes profile from the active layers.
+func (s *appState) Deactivate(profile string) {
+	s.ActiveProfiles = slices.DeleteFunc(s.Active(), func(active string) bool {
+		return active == profile
+	})
+
+	s.CurrentProfile = ""
+	if len(s.ActiveProfiles) > 0 {
+		s.CurrentProfile = s.ActiveProfiles[len(s.ActiveProfiles)-1]
+	}
 }
 
 var State *appState
@@ -41,10 +87,54 @@ func ModulesDir() (string, error) {
 	return subDir("modules")
 }
 
+// ProfilesLocation is where profiles are kept when it is set, otherwise they
+// are kept in the profiles directory of DfmDir.
+var ProfilesLocation string
+
 func ProfilesDir() (string, error) {
+	if ProfilesLocation != "" {
+		return ProfilesLocation, os.MkdirAll(ProfilesLocation, 0744)
+	}
+
 	return subDir("profiles")
 }
 
+// StateDir returns the dfm directory of $XDG_STATE_HOME. Unlike DfmDir, which
+// is a cache directory, it holds what can't be recreated if it is deleted.
+func StateDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := mapping.ResolveRoot(mapping.RootXDGState, home)
+	if err != nil {
+		return "", err
+	}
+
+	d := filepath.Join(dir, "dfm")
+	return d, os.MkdirAll(d, 0744)
+}
+
+// BackupsDir returns the backups directory of StateDir, backups hold the only
+// copy of the files dfm moved out of the way.
+func BackupsDir() (string, error) {
+	d, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+
+	backupsDir := filepath.Join(d, "backups")
+	return backupsDir, os.MkdirAll(backupsDir, 0744)
+}
+
+// LegacyBackupsDir returns the backups directory of DfmDir, where backups were
+// kept before they moved to BackupsDir.
+func LegacyBackupsDir() (string, error) {
+	d, err := DfmDir()
+	return filepath.Join(d, "backups"), err
+}
+
 func Load() error {
 	if State != nil {
 		return nil
@@ -3,6 +3,7 @@ package state
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -48,6 +49,44 @@ func TestProfilesAndModulesDir(t *testing.T) {
 	}
 }
 
+func TestBackupsDirIsNotInTheCache(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	dir, err := BackupsDir()
+	if err != nil {
+		t.Fatalf("BackupsDir returned error: %v", err)
+	}
+
+	if want := filepath.Join(stateHome, "dfm", "backups"); dir != want {
+		t.Fatalf("BackupsDir = %q, want %q", dir, want)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("expected %q to be created, got %v", dir, err)
+	}
+}
+
+func TestProfilesDirUsesProfilesLocation(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	ProfilesLocation = filepath.Join(t.TempDir(), "dotfiles")
+	t.Cleanup(func() { ProfilesLocation = "" })
+
+	dir, err := ProfilesDir()
+	if err != nil {
+		t.Fatalf("ProfilesDir returned error: %v", err)
+	}
+
+	if dir != ProfilesLocation {
+		t.Fatalf("ProfilesDir = %q, want %q", dir, ProfilesLocation)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("expected %q to be created, got %v", dir, err)
+	}
+}
+
 func TestLoadCreatesEmptyStateWhenNoFile(t *testing.T) {
 	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 	State = nil
@@ -90,3 +129,40 @@ func TestSaveAndLoadRoundTrip(t *testing.T) {
 		t.Fatalf("CurrentProfile after Load = %q, want %q", State.CurrentProfile, "/tmp/profile")
 	}
 }
+
+func TestActiveProfileLayers(t *testing.T) {
+	s := &appState{CurrentProfile: "/profiles/legacy"}
+	if got := s.Active(); len(got) != 1 || got[0] != "/profiles/legacy" {
+		t.Fatalf("Active() for legacy state = %v, want [/profiles/legacy]", got)
+	}
+
+	s.SetActive("/profiles/base")
+	s.PushLayer("/profiles/work")
+	s.PushLayer("/profiles/pair")
+
+	want := []string{"/profiles/base", "/profiles/work", "/profiles/pair"}
+	if got := s.Active(); !slices.Equal(got, want) {
+		t.Fatalf("Active() = %v, want %v", got, want)
+	}
+
+	s.PushLayer("/profiles/work")
+	want = []string{"/profiles/base", "/profiles/pair", "/profiles/work"}
+	if got := s.Active(); !slices.Equal(got, want) {
+		t.Fatalf("Active() after re-pushing = %v, want %v", got, want)
+	}
+
+	if s.CurrentProfile != "/profiles/work" {
+		t.Fatalf("CurrentProfile = %q, want the top layer", s.CurrentProfile)
+	}
+
+	s.Deactivate("/profiles/work")
+	if s.CurrentProfile != "/profiles/pair" {
+		t.Fatalf("CurrentProfile after Deactivate = %q, want %q", s.CurrentProfile, "/profiles/pair")
+	}
+
+	s.Deactivate("/profiles/pair")
+	s.Deactivate("/profiles/base")
+	if s.CurrentProfile != "" || len(s.Active()) != 0 {
+		t.Fatalf("expected no active profiles, got %q %v", s.CurrentProfile, s.Active())
+	}
+}
@@ -0,0 +1,25 @@
+package utils
+
+import "testing"
+
+func TestIsWithin(t *testing.T) {
+	cases := []struct {
+		path, dir string
+		want      bool
+	}{
+		{"/home/me/.config", "/home/me", true},
+		{"/home/me", "/home/me", true},
+		{"/home/me/", "/home/me", true},
+		{"/home/me/.config", "/home/me/", true},
+		{"/home/me/../you", "/home/me", false},
+		{"/home/meow", "/home/me", false},
+		{"/home/me/..dotdot", "/home/me", true},
+		{"/home", "/home/me", false},
+	}
+
+	for _, tc := range cases {
+		if got := IsWithin(tc.path, tc.dir); got != tc.want {
+			t.Fatalf("IsWithin(%q, %q) = %v, want %v", tc.path, tc.dir, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestClosest(t *testing.T) {
+	candidates := []string{"skip", "dest", "link_as_dir", "target_os"}
+
+	cases := map[string]string{
+		"sikp":       "skip",
+		"dset":       "dest",
+		"link_asdir": "link_as_dir",
+		"targetos":   "target_os",
+		"script":     "",
+		"x":          "",
+	}
+
+	for word, want := range cases {
+		if got := Closest(word, candidates); got != want {
+			t.Fatalf("Closest(%q) = %q, want %q", word, got, want)
+		}
+	}
+}